@@ -0,0 +1,282 @@
+package engine
+
+import (
+	"image"
+	"math/bits"
+	"sync"
+)
+
+// The  BitGrid is  a bit-packed  grid: every  row  consists of  uint64
+// words, each holding 64 cells, bit 0  is the leftmost cell of a word.
+// The next generation of  a whole word is computed at  once: we shift
+// the 8  neighbor words into  place and sum them  up using bit-sliced
+// adders, so that  we get the neighbor count of all  64 cells in four
+// bit planes. Those  are then matched against the rule,  which is also
+// done with bitwise logic only.
+
+const WORDBITS = 64
+
+type BitGrid struct {
+	Width, Height int
+	Words         int      // words per row
+	Cells, Next   []uint64 // current and next generation
+	Blank         []uint64 // empty row used outside the grid
+	Wrap          bool
+	Birth         uint16 // bit n set: born with n neighbors
+	Survive       uint16 // bit n set: survives with n neighbors
+	LastMask      uint64 // valid bits of the last word of a row
+
+	strobe     Strobe // phase of B0 rules, see strobe.go
+	generation int64
+}
+
+func NewBitGrid(options Options) *BitGrid {
+	words := (options.Width + WORDBITS - 1) / WORDBITS
+
+	grid := &BitGrid{
+		Width:    options.Width,
+		Height:   options.Height,
+		Words:    words,
+		Cells:    make([]uint64, words*options.Height),
+		Next:     make([]uint64, words*options.Height),
+		Blank:    make([]uint64, words),
+		Wrap:     options.Wrap,
+		LastMask: ^uint64(0),
+	}
+
+	if rest := options.Width % WORDBITS; rest != 0 {
+		grid.LastMask = 1<<rest - 1
+	}
+
+	grid.SetRule(options.Rule)
+
+	return grid
+}
+
+func (grid *BitGrid) SetRule(rule *Rule) {
+	grid.strobe.SetRule(rule)
+	grid.SetMasks(rule)
+}
+
+// turn the rule into neighbor count masks
+func (grid *BitGrid) SetMasks(rule *Rule) {
+	grid.Birth = 0
+	grid.Survive = 0
+
+	for _, count := range rule.Birth {
+		grid.Birth |= 1 << count
+	}
+
+	for _, count := range rule.Death {
+		grid.Survive |= 1 << count
+	}
+}
+
+func (grid *BitGrid) Generation() int64 {
+	return grid.generation
+}
+
+func (grid *BitGrid) Inverted() bool {
+	return grid.strobe.Inverted
+}
+
+func (grid *BitGrid) SetInverted(inverted bool) {
+	grid.strobe.Inverted = inverted
+}
+
+func (grid *BitGrid) Population() int64 {
+	var population int64
+
+	for _, word := range grid.Cells {
+		population += int64(bits.OnesCount64(word))
+	}
+
+	return population
+}
+
+func (grid *BitGrid) Get(x, y int) uint8 {
+	if x < 0 || y < 0 || x >= grid.Width || y >= grid.Height {
+		return Dead
+	}
+
+	return uint8(grid.Cells[y*grid.Words+x/WORDBITS] >> (x % WORDBITS) & 1)
+}
+
+func (grid *BitGrid) Set(x, y int, state uint8) {
+	if x < 0 || y < 0 || x >= grid.Width || y >= grid.Height {
+		return
+	}
+
+	bit := uint64(1) << (x % WORDBITS)
+	idx := y*grid.Words + x/WORDBITS
+
+	if state == Alive {
+		grid.Cells[idx] |= bit
+	} else {
+		grid.Cells[idx] &^= bit
+	}
+}
+
+// call action for every life cell inside rect
+func (grid *BitGrid) Each(rect image.Rectangle, action func(x, y int)) {
+	rect = rect.Intersect(image.Rect(0, 0, grid.Width, grid.Height))
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for word := rect.Min.X / WORDBITS; word*WORDBITS < rect.Max.X; word++ {
+			cells := grid.Cells[y*grid.Words+word]
+
+			for cells != 0 {
+				x := word*WORDBITS + bits.TrailingZeros64(cells)
+				cells &= cells - 1
+
+				if x >= rect.Min.X && x < rect.Max.X {
+					action(x, y)
+				}
+			}
+		}
+	}
+}
+
+// return the bounding box of all life cells
+func (grid *BitGrid) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	grid.Each(image.Rect(0, 0, grid.Width, grid.Height), func(x, y int) {
+		bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+	})
+
+	return bounds
+}
+
+func (grid *BitGrid) Step(generations int64) {
+	for ; generations > 0; generations-- {
+		grid.StepOnce()
+	}
+}
+
+// compute the next generation, one goroutine per row
+func (grid *BitGrid) StepOnce() {
+	if grid.strobe.Active() {
+		grid.SetMasks(grid.strobe.Next())
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(grid.Height)
+
+	for y := 0; y < grid.Height; y++ {
+		go func() {
+			defer wg.Done()
+			grid.StepRow(y)
+		}()
+	}
+
+	wg.Wait()
+
+	grid.Cells, grid.Next = grid.Next, grid.Cells
+	grid.generation++
+}
+
+// return the given row, or an empty one if it is outside the grid
+func (grid *BitGrid) Row(y int) []uint64 {
+	if grid.Wrap {
+		y = (y + grid.Height) % grid.Height
+	} else if y < 0 || y >= grid.Height {
+		return grid.Blank
+	}
+
+	return grid.Cells[y*grid.Words : (y+1)*grid.Words]
+}
+
+// return the word with every cell replaced by its left (west) and right
+// (east) neighbor, including the bits shifted in from adjacent words
+func (grid *BitGrid) Shifted(row []uint64, word int) (uint64, uint64) {
+	last := grid.Words - 1
+
+	var westcarry, eastcarry uint64
+
+	switch {
+	case word > 0:
+		westcarry = row[word-1] >> (WORDBITS - 1)
+	case grid.Wrap:
+		westcarry = row[last] >> ((grid.Width - 1) % WORDBITS) & 1
+	}
+
+	switch {
+	case word < last:
+		eastcarry = (row[word+1] & 1) << (WORDBITS - 1)
+	case grid.Wrap:
+		eastcarry = (row[0] & 1) << ((grid.Width - 1) % WORDBITS)
+	}
+
+	return row[word]<<1 | westcarry, row[word]>>1 | eastcarry
+}
+
+func (grid *BitGrid) StepRow(y int) {
+	above := grid.Row(y - 1)
+	row := grid.Row(y)
+	below := grid.Row(y + 1)
+
+	for word := 0; word < grid.Words; word++ {
+		// neighbor count as 4 bit planes
+		var sum0, sum1, sum2, sum3 uint64
+
+		add := func(cells uint64) {
+			carry0 := sum0 & cells
+			sum0 ^= cells
+			carry1 := sum1 & carry0
+			sum1 ^= carry0
+			carry2 := sum2 & carry1
+			sum2 ^= carry1
+			sum3 |= carry2
+		}
+
+		aboveW, aboveE := grid.Shifted(above, word)
+		rowW, rowE := grid.Shifted(row, word)
+		belowW, belowE := grid.Shifted(below, word)
+
+		add(aboveW)
+		add(above[word])
+		add(aboveE)
+		add(rowW)
+		add(rowE)
+		add(belowW)
+		add(below[word])
+		add(belowE)
+
+		current := row[word]
+		var next uint64
+
+		for count := 0; count <= 8; count++ {
+			born := grid.Birth&(1<<count) != 0
+			survives := grid.Survive&(1<<count) != 0
+
+			if !born && !survives {
+				continue
+			}
+
+			// all cells having exactly count neighbors
+			match := ^uint64(0)
+			for plane, sum := range []uint64{sum0, sum1, sum2, sum3} {
+				if count&(1<<plane) != 0 {
+					match &= sum
+				} else {
+					match &^= sum
+				}
+			}
+
+			if born {
+				next |= match &^ current
+			}
+
+			if survives {
+				next |= match & current
+			}
+		}
+
+		if word == grid.Words-1 {
+			next &= grid.LastMask
+		}
+
+		grid.Next[y*grid.Words+word] = next
+	}
+}
@@ -0,0 +1,210 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"strconv"
+	"strings"
+)
+
+// Elementary cellular automata, see
+// https://mathworld.wolfram.com/ElementaryCellularAutomaton.html
+//
+// A rule like W110 works on a single row of cells. The next state of a
+// cell depends on itself and its left and right neighbor, those three
+// cells form a number between 0 and 7, which selects the bit of the rule
+// number giving the next state. W110 is 01101110 in binary, so 111 dies,
+// 110 lives, 101 lives and so on.
+//
+// The universe shows the history of the row: every generation is a new
+// row below the previous one, starting at the top. Once the grid is
+// full, it scrolls up, so the oldest row drops out.
+
+// true if the rule string is an elementary rule like W110
+func IsElementary(rule string) bool {
+	if len(rule) < 2 || strings.ToUpper(rule)[0] != 'W' {
+		return false
+	}
+
+	_, err := strconv.Atoi(rule[1:])
+
+	return err == nil
+}
+
+// parse an elementary rule
+func ParseElementary(rule string) (*Rule, error) {
+	number, err := strconv.Atoi(rule[1:])
+	if err != nil || number < 0 || number > 255 {
+		return nil, fmt.Errorf("invalid elementary game rule <%s>, expecting W0..W255", rule)
+	}
+
+	return &Rule{
+		Definition: rule,
+		States:     2,
+		Elementary: true,
+		Wolfram:    uint8(number),
+	}, nil
+}
+
+// a  one-dimensional  universe, Height  is the  number of  generations
+// visible at once
+type Elementary struct {
+	Width, Height int
+	Wrap          bool // the row wraps around at its ends
+
+	rule       *Rule
+	rows       [][]uint8 // ring buffer, first is the oldest row
+	first      int
+	count      int // number of rows in use, the last one is the current generation
+	next       []uint8
+	generation int64
+}
+
+func NewElementary(options Options) *Elementary {
+	universe := &Elementary{
+		Width:  options.Width,
+		Height: options.Height,
+		Wrap:   options.Wrap,
+		rows:   make([][]uint8, options.Height),
+		next:   make([]uint8, options.Width),
+	}
+
+	for y := range universe.rows {
+		universe.rows[y] = make([]uint8, options.Width)
+	}
+
+	universe.SetRule(options.Rule)
+
+	return universe
+}
+
+func (universe *Elementary) SetRule(rule *Rule) {
+	universe.rule = rule
+}
+
+func (universe *Elementary) Inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < universe.Width && y < universe.Height
+}
+
+// the row shown at the given position, oldest first
+func (universe *Elementary) Row(y int) []uint8 {
+	return universe.rows[(universe.first+y)%universe.Height]
+}
+
+func (universe *Elementary) Get(x, y int) uint8 {
+	if !universe.Inside(x, y) || y >= universe.count {
+		return Dead
+	}
+
+	return universe.Row(y)[x]
+}
+
+// set a cell of the  given row, rows below the current  one are added.
+// Only the last row affects the next generation.
+func (universe *Elementary) Set(x, y int, state uint8) {
+	if !universe.Inside(x, y) {
+		return
+	}
+
+	for universe.count <= y {
+		clear(universe.Row(universe.count))
+		universe.count++
+	}
+
+	if state != Dead {
+		state = Alive
+	}
+
+	universe.Row(y)[x] = state
+}
+
+// call action for every life cell inside rect
+func (universe *Elementary) Each(rect image.Rectangle, action func(x, y int)) {
+	rect = rect.Intersect(image.Rect(0, 0, universe.Width, universe.count))
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		row := universe.Row(y)
+
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if row[x] != Dead {
+				action(x, y)
+			}
+		}
+	}
+}
+
+// return the bounding box of all life cells shown
+func (universe *Elementary) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	universe.Each(image.Rect(0, 0, universe.Width, universe.Height), func(x, y int) {
+		bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+	})
+
+	return bounds
+}
+
+// number of life cells shown, not only those of the current generation
+func (universe *Elementary) Population() int64 {
+	var population int64
+
+	universe.Each(image.Rect(0, 0, universe.Width, universe.Height), func(x, y int) {
+		population++
+	})
+
+	return population
+}
+
+func (universe *Elementary) Generation() int64 {
+	return universe.generation
+}
+
+func (universe *Elementary) Step(generations int64) {
+	for ; generations > 0; generations-- {
+		universe.StepOnce()
+	}
+}
+
+// compute the next row from the current one and append it
+func (universe *Elementary) StepOnce() {
+	if universe.count == 0 {
+		// nothing has been set yet, start with an empty row
+		clear(universe.Row(0))
+		universe.count = 1
+	}
+
+	current := universe.Row(universe.count - 1)
+
+	for x := range universe.next {
+		pattern := universe.Cell(current, x-1)<<2 | current[x]<<1 | universe.Cell(current, x+1)
+		universe.next[x] = (universe.rule.Wolfram >> pattern) & 1
+	}
+
+	var index int
+
+	if universe.count < universe.Height {
+		index = (universe.first + universe.count) % universe.Height
+		universe.count++
+	} else {
+		// scroll, the oldest row is replaced
+		index = universe.first
+		universe.first = (universe.first + 1) % universe.Height
+	}
+
+	universe.rows[index], universe.next = universe.next, universe.rows[index]
+	universe.generation++
+}
+
+// state of a cell of the given row, cells beyond the ends are dead
+// unless the row wraps around
+func (universe *Elementary) Cell(row []uint8, x int) uint8 {
+	if universe.Wrap {
+		return row[(x+universe.Width)%universe.Width]
+	}
+
+	if x < 0 || x >= universe.Width {
+		return Dead
+	}
+
+	return row[x]
+}
@@ -0,0 +1,175 @@
+// Package engine  contains the  cellular automaton simulation  used by
+// golsky. It doesn't depend on  any user interface, so it can be used
+// to run golsky simulations in other tools or in tests.
+//
+// There are multiple  engines, all of them implement  the Stepper
+// interface and can be created using New():
+//
+//	grid:       flat grid, only regions which changed are evaluated
+//	bitgrid:    bit-packed flat grid, 64 cells are computed at once
+//	hashlife:   quadtree with memoized results, unbounded
+//	plane:      sparse tile store, unbounded
+//	elementary: one-dimensional rules like W110, one row per generation
+//
+// Bounded  universes span from 0,0  to Width,Height, cells outside are
+// dead. Unbounded universes use signed coordinates.
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"strings"
+)
+
+const (
+	Alive = 1
+	Dead  = 0
+
+	GRID     = "grid"
+	BITGRID  = "bitgrid"
+	HASHLIFE = "hashlife"
+	PLANE    = "plane"
+
+	ELEMENTARY = "elementary"
+)
+
+var ENGINES = []string{GRID, BITGRID, HASHLIFE, PLANE, ELEMENTARY}
+
+// settings used to create a new engine
+type Options struct {
+	Width, Height int   // size of a bounded universe, initial area otherwise
+	Wrap          bool  // bounded universe only: wrap around the edges
+	Rule          *Rule // the rule to use
+
+	// how the edges are joined in wrap mode, a torus by default
+	Topology Topology
+}
+
+// A Universe provides  access to the cells of  a simulation engine.
+// Coordinates outside of a bounded universe are dead and can't be set.
+// With Generations rules  cells may have more  states than Dead and
+// Alive, such dying cells are visited by Each() and counted as well.
+type Universe interface {
+	Get(x, y int) uint8
+	Set(x, y int, state uint8)
+	Each(rect image.Rectangle, action func(x, y int)) // visit non-dead cells inside rect
+	Bounds() image.Rectangle                          // bounding box of all non-dead cells
+	Population() int64                                // number of non-dead cells
+}
+
+// A Stepper is a Universe which can be advanced in time
+type Stepper interface {
+	Universe
+
+	Step(generations int64)
+	Generation() int64 // number of generations computed so far
+	SetRule(rule *Rule)
+}
+
+// Implemented by engines which keep track of cell changes
+type Tracer interface {
+	// generation in which the cell changed its state the last time, 0 if never
+	Age(x, y int) int64
+}
+
+// Implemented by engines which only evaluate the active parts of a universe
+type Tracker interface {
+	// number of cells evaluated during the last generation
+	ActiveCells() int
+}
+
+// Implemented by engines which support B0 rules, see strobe.go. If the
+// universe is inverted, the background is alive and the cells are stored
+// as complement: dead cells are alive and vice versa.
+type Inverter interface {
+	Inverted() bool
+	SetInverted(inverted bool) // restore the phase of a saved universe
+}
+
+// check if the given engine can be used with the options
+func Check(name string, options Options) error {
+	rule := options.Rule
+	if rule == nil {
+		rule = &Rule{}
+	}
+
+	if options.Wrap && options.Topology.Kind == SPHERE && options.Width != options.Height {
+		return errors.New("a sphere must be square")
+	}
+
+	if rule.Elementary != (name == ELEMENTARY) {
+		return fmt.Errorf("the %s engine can only be used with one-dimensional rules like W110", ELEMENTARY)
+	}
+
+	switch name {
+	case GRID:
+		return nil
+	case ELEMENTARY:
+		if options.Wrap && options.Topology.Twisted() {
+			return fmt.Errorf("the %s engine only supports a torus", name)
+		}
+
+		return nil
+	case BITGRID, HASHLIFE, PLANE:
+		// only the flat grid knows about large neighborhoods and rule files
+		switch {
+		case rule.IsLargerThanLife():
+			return fmt.Errorf("the %s engine does not support Larger than Life rules", name)
+		case rule.Table != nil:
+			return fmt.Errorf("the %s engine does not support rule files", name)
+		}
+	default:
+		return fmt.Errorf("unknown engine %s, expecting one of: %s",
+			name, strings.Join(ENGINES, ", "))
+	}
+
+	switch name {
+	case BITGRID:
+		switch {
+		case options.Wrap && options.Topology.Twisted():
+			return fmt.Errorf("the %s engine only supports a torus", name)
+		case rule.IsGenerations():
+			return fmt.Errorf("the %s engine does not support Generations rules", name)
+		case rule.HasReducedNeighborhood():
+			return fmt.Errorf("the %s engine does not support hexagonal or von Neumann neighborhoods", name)
+		case rule.NonTotalistic:
+			return fmt.Errorf("the %s engine does not support non-totalistic rules", name)
+		}
+	case HASHLIFE, PLANE:
+		switch {
+		case options.Wrap:
+			return fmt.Errorf("the %s engine does not support wrap around mode", name)
+		case rule.HasB0() && (name == HASHLIFE || !rule.Strobes()):
+			return fmt.Errorf("the %s engine does not support this B0 rule", name)
+		case rule.IsGenerations() && name == HASHLIFE:
+			return fmt.Errorf("the %s engine does not support Generations rules", name)
+		}
+	}
+
+	return nil
+}
+
+// create the engine with the given name
+func New(name string, options Options) (Stepper, error) {
+	if options.Rule == nil {
+		return nil, errors.New("no rule given")
+	}
+
+	if err := Check(name, options); err != nil {
+		return nil, err
+	}
+
+	switch name {
+	case BITGRID:
+		return NewBitGrid(options), nil
+	case HASHLIFE:
+		return NewHashLife(options), nil
+	case PLANE:
+		return NewPlane(options), nil
+	case ELEMENTARY:
+		return NewElementary(options), nil
+	}
+
+	return NewGrid(options), nil
+}
@@ -0,0 +1,1108 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"math/rand"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const (
+	testSize        = 128
+	testSoup        = 16
+	testGenerations = 30
+)
+
+// fill a small soup in the center of the universe,  so that it can't
+// reach the edges within the tested generations
+func fillSoup(universe Universe, seed int64) {
+	random := rand.New(rand.NewSource(seed))
+	offset := (testSize - testSoup) / 2
+
+	for y := 0; y < testSoup; y++ {
+		for x := 0; x < testSoup; x++ {
+			if random.Intn(3) == 0 {
+				universe.Set(x+offset, y+offset, Alive)
+			}
+		}
+	}
+}
+
+func parseRule(t testing.TB, definition string) *Rule {
+	t.Helper()
+
+	rule, err := ParseGameRule(definition)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rule
+}
+
+func compare(t *testing.T, name string, expect, got Universe, size int) {
+	t.Helper()
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			if expect.Get(x, y) != got.Get(x, y) {
+				t.Fatalf("%s: cell %d,%d differs, expected %d, got %d",
+					name, x, y, expect.Get(x, y), got.Get(x, y))
+			}
+		}
+	}
+
+	if expect.Population() != got.Population() {
+		t.Errorf("%s: population differs, expected %d, got %d",
+			name, expect.Population(), got.Population())
+	}
+
+	if expect.Bounds() != got.Bounds() {
+		t.Errorf("%s: bounds differ, expected %v, got %v",
+			name, expect.Bounds(), got.Bounds())
+	}
+}
+
+// the next state of a cell computed the naive way, get returns the
+// cells around it relative to its position
+type referenceRule func(state uint8, get func(dx, dy int) uint8) uint8
+
+// compute the universe generation by generation using next and compare
+// it with the engine, which has to be filled already. The geometry of
+// the reference is taken from options: cells outside of it are dead,
+// unless it wraps around its topology. The cells of an inverted B0
+// universe are complemented.
+func compareWithReference(t *testing.T, name string, stepper Stepper, options Options, generations int,
+	next referenceRule) {
+	t.Helper()
+
+	width, height := options.Width, options.Height
+	expect := make([]uint8, width*height)
+	following := make([]uint8, width*height)
+
+	for idx := range expect {
+		expect[idx] = stepper.Get(idx%width, idx/width)
+	}
+
+	for generation := 0; generation < generations; generation++ {
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				get := func(dx, dy int) uint8 {
+					col, row := x+dx, y+dy
+					inside := col >= 0 && row >= 0 && col < width && row < height
+
+					if options.Wrap {
+						col, row, inside = options.Topology.Map(col, row, width, height)
+					}
+
+					if !inside {
+						return Dead
+					}
+
+					return expect[row*width+col]
+				}
+
+				following[y*width+x] = next(expect[y*width+x], get)
+			}
+		}
+
+		expect, following = following, expect
+	}
+
+	stepper.Step(int64(generations))
+
+	inverter, ok := stepper.(Inverter)
+	inverted := ok && inverter.Inverted()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			state := stepper.Get(x, y)
+			if inverted {
+				state ^= Alive
+			}
+
+			if state != expect[y*width+x] {
+				t.Fatalf("%s: cell %d,%d: expected %d, got %d", name, x, y, expect[y*width+x], state)
+			}
+		}
+	}
+}
+
+// the reference of a rule with the 8 Moore neighbors, which are passed
+// as count or as neighborhood mask for Hensel rules
+func mooreReference(rule *Rule) referenceRule {
+	return func(state uint8, get func(dx, dy int) uint8) uint8 {
+		var neighbors uint8
+
+		for bit, offset := range NEIGHBORHOOD {
+			if rule.NonTotalistic {
+				neighbors |= get(offset.X, offset.Y) << bit
+			} else {
+				neighbors += get(offset.X, offset.Y)
+			}
+		}
+
+		return rule.CheckRuleGeneric(state, neighbors)
+	}
+}
+
+// the reference of a rule counting the life cells at the given offsets
+func countingReference(rule *Rule, offsets []image.Point) referenceRule {
+	// the tables are indexed by mask, use the counts instead. The
+	// generations checker works for 2 states as well.
+	counting := *rule
+	counting.NonTotalistic = false
+
+	return func(state uint8, get func(dx, dy int) uint8) uint8 {
+		var count uint8
+
+		for _, offset := range offsets {
+			if get(offset.X, offset.Y) == Alive {
+				count++
+			}
+		}
+
+		return counting.CheckRuleGenerations(state, count)
+	}
+}
+
+// the reference of a Larger than Life rule, counting every cell of the
+// range one by one
+func ltlReference(rule *Rule) referenceRule {
+	return func(state uint8, get func(dx, dy int) uint8) uint8 {
+		count := 0
+
+		for dy := -rule.Range; dy <= rule.Range; dy++ {
+			for dx := -rule.Range; dx <= rule.Range; dx++ {
+				distance := max(dx, -dx, dy, -dy)
+				if rule.Neighborhood == VON_NEUMANN {
+					distance = max(dx, -dx) + max(dy, -dy)
+				}
+
+				if distance > rule.Range || (dx == 0 && dy == 0 && !rule.Middle) {
+					continue
+				}
+
+				if get(dx, dy) == Alive {
+					count++
+				}
+			}
+		}
+
+		return rule.CheckLargerThanLife(state, count)
+	}
+}
+
+func TestEngines(t *testing.T) {
+	for _, rule := range []string{"B3/S23", "B36/S23", "B3678/S34678"} {
+		options := Options{Width: testSize, Height: testSize, Rule: parseRule(t, rule)}
+
+		reference := NewGrid(options)
+		fillSoup(reference, 42)
+		reference.Step(testGenerations)
+
+		for _, name := range []string{BITGRID, HASHLIFE, PLANE} {
+			stepper, err := New(name, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fillSoup(stepper, 42)
+			stepper.Step(testGenerations)
+
+			if stepper.Generation() != testGenerations {
+				t.Errorf("%s: expected generation %d, got %d",
+					name, testGenerations, stepper.Generation())
+			}
+
+			compare(t, name+" "+rule, reference, stepper, testSize)
+		}
+	}
+}
+
+// the bitgrid is meant to be an order of magnitude faster than the grid
+// on large universes, compare with: go test -bench . ./engine
+func benchmarkEngine(b *testing.B, name string) {
+	options := Options{Width: 1500, Height: 1500, Wrap: true, Rule: parseRule(b, "B3/S23")}
+
+	stepper, err := New(name, options)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	random := rand.New(rand.NewSource(1))
+
+	for y := 0; y < options.Height; y++ {
+		for x := 0; x < options.Width; x++ {
+			if random.Intn(3) == 0 {
+				stepper.Set(x, y, Alive)
+			}
+		}
+	}
+
+	b.ResetTimer()
+	stepper.Step(int64(b.N))
+}
+
+func BenchmarkGrid(b *testing.B) {
+	benchmarkEngine(b, GRID)
+}
+
+func BenchmarkBitGrid(b *testing.B) {
+	benchmarkEngine(b, BITGRID)
+}
+
+func TestWrap(t *testing.T) {
+	// sizes not being a multiple of 64 or TILE_SIZE are the interesting ones
+	for _, width := range []int{30, 64, 100} {
+		options := Options{Width: width, Height: 20, Wrap: true, Rule: parseRule(t, "B3/S23")}
+
+		grid := NewGrid(options)
+		bitgrid := NewBitGrid(options)
+
+		random := rand.New(rand.NewSource(int64(width)))
+
+		for y := 0; y < options.Height; y++ {
+			for x := 0; x < options.Width; x++ {
+				if random.Intn(3) == 0 {
+					grid.Set(x, y, Alive)
+					bitgrid.Set(x, y, Alive)
+				}
+			}
+		}
+
+		grid.Step(testGenerations)
+		bitgrid.Step(testGenerations)
+
+		compare(t, "bitgrid wrap", grid, bitgrid, width)
+	}
+}
+
+func TestHashLifeStepSize(t *testing.T) {
+	options := Options{Rule: parseRule(t, "B3/S23")}
+
+	single := NewHashLife(options)
+	leaps := NewHashLife(options)
+
+	fillSoup(single, 7)
+	fillSoup(leaps, 7)
+
+	for i := 0; i < 100; i++ {
+		single.Step(1)
+	}
+
+	leaps.Step(100)
+
+	if leaps.Generation() != 100 {
+		t.Errorf("expected generation 100, got %d", leaps.Generation())
+	}
+
+	rect := single.Bounds().Union(leaps.Bounds())
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if single.Get(x, y) != leaps.Get(x, y) {
+				t.Fatalf("cell %d,%d differs", x, y)
+			}
+		}
+	}
+}
+
+func TestUnbounded(t *testing.T) {
+	options := Options{Rule: parseRule(t, "B3/S23")}
+
+	for _, name := range []string{HASHLIFE, PLANE} {
+		stepper, err := New(name, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// glider moving north west, across the origin
+		for _, cell := range []image.Point{{0, 0}, {1, 0}, {2, 0}, {0, 1}, {1, 2}} {
+			stepper.Set(cell.X+1, cell.Y+1, Alive)
+		}
+
+		stepper.Step(40)
+
+		expect := image.Rect(-9, -9, -6, -6)
+		if stepper.Bounds() != expect {
+			t.Errorf("%s: expected glider at %v, got %v", name, expect, stepper.Bounds())
+		}
+
+		if stepper.Population() != 5 {
+			t.Errorf("%s: expected population 5, got %d", name, stepper.Population())
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	b0 := parseRule(t, "B03/S23")
+
+	tests := []struct {
+		name    string
+		options Options
+		fail    bool
+	}{
+		{GRID, Options{Wrap: true, Rule: b0}, false},
+		{BITGRID, Options{Wrap: true}, false},
+		{HASHLIFE, Options{Wrap: true}, true},
+		{PLANE, Options{Rule: b0}, false},
+		{HASHLIFE, Options{Rule: b0}, true},
+		{"nonexistent", Options{}, true},
+	}
+
+	for _, test := range tests {
+		err := Check(test.name, test.options)
+		if (err != nil) != test.fail {
+			t.Errorf("%s: unexpected result: %v", test.name, err)
+		}
+	}
+}
+
+func TestGenerations(t *testing.T) {
+	tests := []struct {
+		rule   string
+		birth  []uint8
+		death  []uint8
+		states int
+	}{
+		{"B3/S23", []uint8{3}, []uint8{2, 3}, 2},
+		{"B2/S/C3", []uint8{2}, []uint8{}, 3},
+		{"345/2/4", []uint8{2}, []uint8{3, 4, 5}, 4},
+	}
+
+	for _, test := range tests {
+		rule := parseRule(t, test.rule)
+
+		if !reflect.DeepEqual(rule.Birth, test.birth) ||
+			!reflect.DeepEqual(rule.Death, test.death) || rule.States != test.states {
+			t.Errorf("%s: parsed to unexpected rule %+v", test.rule, rule)
+		}
+
+		if !rule.IsGenerations() {
+			continue
+		}
+
+		options := Options{Width: testSize, Height: testSize, Rule: rule}
+
+		grid := NewGrid(options)
+		plane := NewPlane(options)
+
+		fillSoup(grid, 3)
+		fillSoup(plane, 3)
+
+		grid.Step(testGenerations)
+		plane.Step(testGenerations)
+
+		compare(t, "plane "+test.rule, grid, plane, testSize)
+	}
+
+	// a single cell dies through all refractory states
+	grid := NewGrid(Options{Width: 8, Height: 8, Rule: parseRule(t, "345/2/4")})
+	grid.Set(4, 4, Alive)
+
+	for _, expect := range []uint8{2, 3, Dead} {
+		grid.Step(1)
+
+		if grid.Get(4, 4) != expect {
+			t.Errorf("expected state %d, got %d", expect, grid.Get(4, 4))
+		}
+	}
+}
+
+func TestHensel(t *testing.T) {
+	// the letters of every count partition all configurations
+	letters := map[int]string{
+		1: "ce", 2: "ceaikn", 3: "ceaiknjqry", 4: "ceaiknjqrtwyz",
+		5: "ceaiknjqry", 6: "ceaikn", 7: "ce",
+	}
+
+	for count, list := range letters {
+		seen := map[uint8]bool{}
+
+		for _, letter := range []byte(list) {
+			masks, ok := HenselMasks(count, letter)
+			if !ok {
+				t.Fatalf("letter %c missing for count %d", letter, count)
+			}
+
+			for _, mask := range masks {
+				if seen[mask] || bits.OnesCount8(mask) != count {
+					t.Errorf("%d%c: unexpected mask %08b", count, letter, mask)
+				}
+
+				seen[mask] = true
+			}
+		}
+
+		expect := 0
+		for mask := 0; mask < 256; mask++ {
+			if bits.OnesCount8(uint8(mask)) == count {
+				expect++
+			}
+		}
+
+		if len(seen) != expect {
+			t.Errorf("count %d: %d configurations covered, expected %d", count, len(seen), expect)
+		}
+	}
+
+	// the letters are those of Golly, whose neighborhood bits are NW=1,
+	// N=2, NE=4, W=8, E=32, SW=64, S=128 and SE=256. Counts above 4 use
+	// the complement.
+	golly := map[int]map[byte]int{
+		1: {'c': 1, 'e': 2},
+		2: {'c': 5, 'e': 10, 'a': 3, 'i': 40, 'k': 33, 'n': 68},
+		3: {'c': 69, 'e': 42, 'a': 11, 'i': 7, 'k': 98, 'n': 13, 'j': 14, 'q': 70, 'r': 41, 'y': 97},
+		4: {
+			'c': 325, 'e': 170, 'a': 15, 'i': 45, 'k': 99, 'n': 71, 'j': 106, 'q': 102, 'r': 43,
+			'y': 101, 't': 105, 'w': 78, 'z': 108,
+		},
+	}
+
+	gollyBits := map[int]uint8{1: NW, 2: N, 4: NE, 8: W, 32: E, 64: SW, 128: S, 256: SE}
+
+	for count, configurations := range golly {
+		for letter, neighborhood := range configurations {
+			var mask uint8
+			for bit, position := range gollyBits {
+				if neighborhood&bit != 0 {
+					mask |= position
+				}
+			}
+
+			checks := map[int]uint8{count: mask}
+			if count < 4 {
+				checks[8-count] = ^mask
+			}
+
+			for count, mask := range checks {
+				masks, _ := HenselMasks(count, letter)
+				if !slices.Contains(masks, mask) {
+					t.Errorf("%d%c: mask %08b of Golly missing in %08b", count, letter, mask, masks)
+				}
+			}
+		}
+	}
+
+	// the shapes shown by the LifeWiki
+	shapes := []struct {
+		condition string
+		mask      uint8
+	}{
+		{"2a", NW | N}, {"2c", NW | NE}, {"2e", N | W}, {"2k", NW | E}, {"2i", W | E}, {"2n", NW | SE},
+		{"3i", SW | S | SE}, {"3j", NW | N | E}, {"4t", NW | N | NE | S}, {"4z", NW | N | S | SE},
+	}
+
+	for _, shape := range shapes {
+		masks, _ := HenselMasks(int(shape.condition[0]-'0'), shape.condition[1])
+		if !slices.Contains(masks, shape.mask) {
+			t.Errorf("%s: mask %08b missing", shape.condition, shape.mask)
+		}
+	}
+
+	// with B2a/S a domino splits into two, which move apart at c. The
+	// rows of dominoes evolve like rule 90, after 2^n generations only
+	// the outer two are left. With B2/S the corners of the dominoes give
+	// birth as well.
+	for _, name := range []string{GRID, HASHLIFE, PLANE} {
+		stepper, err := New(name, Options{Width: 60, Height: 60, Rule: parseRule(t, "B2a/S")})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stepper.Set(30, 30, Alive)
+		stepper.Set(31, 30, Alive)
+		stepper.Step(16)
+
+		for _, y := range []int{14, 46} {
+			if stepper.Get(30, y) != Alive || stepper.Get(31, y) != Alive {
+				t.Errorf("%s B2a/S: domino missing at row %d", name, y)
+			}
+		}
+
+		if population := stepper.Population(); population != 4 {
+			t.Errorf("%s B2a/S: expected 4 cells, got %d", name, population)
+		}
+	}
+
+	totalistic := NewGrid(Options{Width: 60, Height: 60, Rule: parseRule(t, "B2/S")})
+	totalistic.Set(30, 30, Alive)
+	totalistic.Set(31, 30, Alive)
+	totalistic.Step(2)
+
+	if totalistic.Get(29, 30) != Alive {
+		t.Errorf("B2/S: cell 29,30 not born from two corners")
+	}
+
+	// listing all letters is the same as the plain count
+	options := Options{Width: testSize, Height: testSize, Rule: parseRule(t, "B3/S23")}
+	reference := NewGrid(options)
+	fillSoup(reference, 11)
+	reference.Step(testGenerations)
+
+	// negated letters leave out the given configurations
+	negated := parseRule(t, "B3cekainyqjr/S2-c3")
+	if !negated.NonTotalistic {
+		t.Fatalf("rule not recognized as non-totalistic")
+	}
+
+	if negated.SurviveTable != parseRule(t, "B3cekainyqjr/S2aeikn3").SurviveTable {
+		t.Errorf("S2-c3 differs from S2aeikn3")
+	}
+
+	options.Rule = parseRule(t, "B3cekainyqjr/S2ceakin3")
+
+	for _, name := range []string{GRID, HASHLIFE, PLANE} {
+		stepper, err := New(name, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		fillSoup(stepper, 11)
+		stepper.Step(testGenerations)
+
+		compare(t, name+" hensel", reference, stepper, testSize)
+	}
+
+	// real non-totalistic rules must give the same result on all engines
+	for _, rule := range []string{"B2-a/S12", "B3aeijr/S23-k"} {
+		options := Options{Width: testSize, Height: testSize, Rule: parseRule(t, rule)}
+
+		reference := NewGrid(options)
+		fillSoup(reference, 5)
+		reference.Step(testGenerations / 3)
+
+		for _, name := range []string{HASHLIFE, PLANE} {
+			stepper, err := New(name, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fillSoup(stepper, 5)
+			stepper.Step(testGenerations / 3)
+
+			compare(t, name+" "+rule, reference, stepper, testSize)
+		}
+	}
+
+	if Check(BITGRID, Options{Rule: parseRule(t, "B2-a/S12")}) == nil {
+		t.Errorf("bitgrid accepted a non-totalistic rule")
+	}
+}
+
+func TestLargerThanLife(t *testing.T) {
+	// range 1 including the middle cell is just Life
+	for _, wrap := range []bool{false, true} {
+		life := NewGrid(Options{Width: 40, Height: 30, Wrap: wrap, Rule: parseRule(t, "B3/S23")})
+		ltl := NewGrid(Options{Width: 40, Height: 30, Wrap: wrap, Rule: parseRule(t, "R1,C0,M1,S3..4,B3..3,NM")})
+
+		random := rand.New(rand.NewSource(1))
+
+		for y := 0; y < 30; y++ {
+			for x := 0; x < 40; x++ {
+				if random.Intn(3) == 0 {
+					life.Set(x, y, Alive)
+					ltl.Set(x, y, Alive)
+				}
+			}
+		}
+
+		life.Step(testGenerations)
+		ltl.Step(testGenerations)
+
+		compare(t, "ltl life", life, ltl, 40)
+	}
+
+	rule := parseRule(t, "R3,C4,M0,S5..9,B6..8,NN")
+	if rule.Range != 3 || rule.States != 4 || rule.Middle || rule.Neighborhood != VON_NEUMANN ||
+		rule.SurviveMin != 5 || rule.SurviveMax != 9 || rule.BirthMin != 6 || rule.BirthMax != 8 {
+		t.Fatalf("parsed to unexpected rule %+v", rule)
+	}
+
+	// compare the summed-area counts with counting cell by cell
+	for _, test := range []struct {
+		rule string
+		wrap bool
+	}{
+		{"R3,C4,M0,S5..9,B6..8,NN", true},
+		{"R2,C3,M1,S6..11,B5..8,NM", false},
+		{"R4,C0,M1,S12..24,B14..20,NM", true},
+	} {
+		options := Options{Width: 25, Height: 20, Wrap: test.wrap, Rule: parseRule(t, test.rule)}
+
+		grid := NewGrid(options)
+		fillRandom(grid, 25, 20, 2)
+
+		compareWithReference(t, test.rule, grid, options, testGenerations, ltlReference(options.Rule))
+	}
+
+	if Check(PLANE, Options{Rule: parseRule(t, "R5,C0,M1,S34..58,B34..45,NM")}) == nil {
+		t.Errorf("plane accepted a Larger than Life rule")
+	}
+
+	// survival and birth ranges don't default to 0
+	for definition, message := range map[string]string{
+		"R5,C0,M1,S34..58": "missing birth range in game rule <R5,C0,M1,S34..58>",
+		"R5,C0,M1,B34..45": "missing survival range in game rule <R5,C0,M1,B34..45>",
+		"C0,M1,S3..4,B3":   "missing range in game rule <C0,M1,S3..4,B3>",
+	} {
+		if _, err := ParseLargerThanLife(definition); err == nil || err.Error() != message {
+			t.Errorf("%s: unexpected error: %v", definition, err)
+		}
+	}
+}
+
+func fillRandom(universe Universe, width, height int, seed int64) {
+	random := rand.New(rand.NewSource(seed))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			universe.Set(x, y, uint8(random.Intn(3)))
+		}
+	}
+}
+
+func TestNeighborhoods(t *testing.T) {
+	tests := []struct {
+		rule      string
+		neighbors []image.Point
+	}{
+		{"B2/S34H", []image.Point{{-1, -1}, {0, -1}, {-1, 0}, {1, 0}, {0, 1}, {1, 1}}},
+		{"B2/S013V", []image.Point{{0, -1}, {-1, 0}, {1, 0}, {0, 1}}},
+		{"12/34/3h", []image.Point{{-1, -1}, {0, -1}, {-1, 0}, {1, 0}, {0, 1}, {1, 1}}},
+	}
+
+	for _, test := range tests {
+		rule := parseRule(t, test.rule)
+		if !rule.HasReducedNeighborhood() {
+			t.Fatalf("%s: neighborhood not recognized", test.rule)
+		}
+
+		options := Options{Width: testSize, Height: testSize, Rule: rule}
+
+		for _, name := range []string{GRID, HASHLIFE, PLANE} {
+			if Check(name, options) != nil {
+				continue
+			}
+
+			stepper, err := New(name, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fillSoup(stepper, 7)
+
+			compareWithReference(t, name+" "+test.rule, stepper, options, testGenerations,
+				countingReference(rule, test.neighbors))
+		}
+	}
+
+	if Check(BITGRID, Options{Rule: parseRule(t, "B2/S34H")}) == nil {
+		t.Errorf("bitgrid accepted a hexagonal rule")
+	}
+}
+
+func TestB0(t *testing.T) {
+	for _, definition := range []string{"B0123478/S01234678", "B03/S23", "B02a/S23"} {
+		rule := parseRule(t, definition)
+
+		// compute the real cells on a torus, which is large enough that
+		// the soup can't reach the edges, so it's the same as an infinite
+		// universe
+		reference := Options{Width: testSize, Height: testSize, Wrap: true}
+
+		for _, name := range []string{GRID, BITGRID, PLANE} {
+			for _, wrap := range []bool{false, true} {
+				options := Options{Width: testSize, Height: testSize, Wrap: wrap, Rule: rule}
+				if Check(name, options) != nil {
+					continue
+				}
+
+				stepper, err := New(name, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				fillSoup(stepper, 9)
+
+				// odd, so that alternating rules end up inverted
+				compareWithReference(t, fmt.Sprintf("%s %s wrap=%t", name, definition, wrap), stepper, reference,
+					testGenerations+1, mooreReference(rule))
+			}
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	rule := parseRule(t, "B3/S23:K40*,30")
+	expect := Topology{Kind: KLEIN_BOTTLE, Width: 40, Height: 30, FlipX: true}
+
+	if rule.Topology != expect || rule.CheckFunc() == nil || len(rule.Birth) != 1 {
+		t.Fatalf("parsed to unexpected rule %+v", rule)
+	}
+
+	if parseRule(t, "B3/S23:T50").Topology != (Topology{Kind: TORUS, Width: 50, Height: 50}) {
+		t.Errorf("single size not used for both dimensions")
+	}
+
+	maps := []struct {
+		topology     Topology
+		x, y         int
+		expectX      int
+		expectY      int
+		expectInside bool
+	}{
+		{Topology{Kind: TORUS}, -1, 10, 39, 10, true},
+		{Topology{Kind: KLEIN_BOTTLE, FlipX: true}, 3, -1, 36, 29, true},
+		{Topology{Kind: KLEIN_BOTTLE, FlipX: true}, -1, 3, 39, 3, true},
+		{Topology{Kind: KLEIN_BOTTLE, FlipY: true}, -1, 3, 39, 26, true},
+		{Topology{Kind: CROSS_SURFACE, FlipX: true, FlipY: true}, 40, 0, 0, 29, true},
+		{Topology{Kind: SPHERE}, 5, -1, 0, 5, true},
+		{Topology{Kind: SPHERE}, -1, 5, 5, 0, true},
+		{Topology{Kind: SPHERE}, 39, 40, 39, 39, true},
+	}
+
+	for _, test := range maps {
+		x, y, inside := test.topology.Map(test.x, test.y, 40, 30)
+		if test.topology.Kind == SPHERE {
+			x, y, inside = test.topology.Map(test.x, test.y, 40, 40)
+		}
+
+		if x != test.expectX || y != test.expectY || inside != test.expectInside {
+			t.Errorf("%c %d,%d: expected %d,%d, got %d,%d",
+				test.topology.Kind, test.x, test.y, test.expectX, test.expectY, x, y)
+		}
+	}
+
+	// the grid with its tile tracking against a plain computation
+	for _, definition := range []string{"B3/S23:K40*,30", "B3/S23:K40,30*", "B36/S23:C40,30", "B3/S23:S40", "B2-a/S12:C40,30"} {
+		rule := parseRule(t, definition)
+		options := Options{
+			Width: rule.Topology.Width, Height: rule.Topology.Height,
+			Wrap: true, Rule: rule, Topology: rule.Topology,
+		}
+
+		grid := NewGrid(options)
+		random := rand.New(rand.NewSource(4))
+
+		for idx := 0; idx < options.Width*options.Height; idx++ {
+			if random.Intn(3) == 0 {
+				grid.Set(idx%options.Width, idx/options.Width, Alive)
+			}
+		}
+
+		compareWithReference(t, definition, grid, options, testGenerations, mooreReference(rule))
+	}
+
+	if Check(BITGRID, Options{Wrap: true, Topology: Topology{Kind: KLEIN_BOTTLE, FlipX: true}}) == nil {
+		t.Errorf("bitgrid accepted a Klein bottle")
+	}
+}
+
+const wireworld = `@RULE WireWorld
+# 0: empty, 1: electron head, 2: electron tail, 3: conductor
+@TABLE
+n_states:4
+neighborhood:Moore
+symmetries:permute
+var a={0,1,2,3}
+var b={a}
+var c={a}
+var d={a}
+var e={a}
+var f={a}
+var g={a}
+var h={a}
+var i={0,2,3}
+var j={i}
+var k={i}
+var l={i}
+var m={i}
+var n={i}
+var o={i}
+1,a,b,c,d,e,f,g,h,2
+2,a,b,c,d,e,f,g,h,3
+3,1,i,j,k,l,m,n,o,1
+3,1,1,j,k,l,m,n,o,1
+@COLORS
+1 0 128 255
+`
+
+func TestRuleTable(t *testing.T) {
+	filename := t.TempDir() + "/WireWorld.rule"
+	if err := os.WriteFile(filename, []byte(wireworld), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rule, err := LoadRuleFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rule.Definition != "WireWorld" || rule.States != 4 || len(rule.Table.Colors) != 1 {
+		t.Fatalf("loaded unexpected rule %+v", rule)
+	}
+
+	const size = 40
+
+	options := Options{Width: size, Height: size, Wrap: true, Rule: rule}
+
+	grid := NewGrid(options)
+	random := rand.New(rand.NewSource(8))
+
+	for idx := 0; idx < size*size; idx++ {
+		grid.Set(idx%size, idx/size, uint8(random.Intn(4)))
+	}
+
+	compareWithReference(t, "table", grid, options, testGenerations,
+		func(state uint8, get func(dx, dy int) uint8) uint8 {
+			heads := 0
+
+			for _, offset := range NEIGHBORHOOD {
+				if get(offset.X, offset.Y) == 1 {
+					heads++
+				}
+			}
+
+			switch {
+			case state == 1:
+				return 2
+			case state == 2:
+				return 3
+			case state == 3 && (heads == 1 || heads == 2):
+				return 1
+			}
+
+			return state
+		})
+
+	// a tree for the von Neumann neighborhood: a cell is alive if an
+	// odd number of its neighbors and itself are alive
+	tree := &strings.Builder{}
+	nodes := 0
+
+	var build func(level, sum int) int
+
+	build = func(level, sum int) int {
+		values := []int{}
+
+		for state := 0; state < 2; state++ {
+			if level == 1 {
+				values = append(values, (sum+state)%2)
+			} else {
+				values = append(values, build(level-1, sum+state))
+			}
+		}
+
+		fmt.Fprintf(tree, "%d %d %d\n", level, values[0], values[1])
+		nodes++
+
+		return nodes - 1
+	}
+
+	build(5, 0)
+
+	table, err := ParseRuleTable(strings.NewReader(fmt.Sprintf(
+		"@RULE Parity\n@TREE\nnum_states=2\nnum_neighbors=4\nnum_nodes=%d\n%s", nodes, tree)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	grid = NewGrid(Options{Width: size, Height: size, Rule: &Rule{Definition: "Parity", States: 2, Table: table}})
+	grid.Set(20, 20, Alive)
+	grid.Step(1)
+
+	for idx := 0; idx < size*size; idx++ {
+		x, y := idx%size, idx/size
+
+		alive := (x == 20 && y == 20) || (x == 20 && (y == 19 || y == 21)) || (y == 20 && (x == 19 || x == 21))
+		if (grid.Get(x, y) == Alive) != alive {
+			t.Fatalf("tree: cell %d,%d: unexpected state %d", x, y, grid.Get(x, y))
+		}
+	}
+
+	if Check(PLANE, Options{Rule: rule}) == nil {
+		t.Errorf("plane accepted a rule file")
+	}
+}
+
+func TestElementary(t *testing.T) {
+	rule := parseRule(t, "W110")
+	if !rule.Elementary || rule.Wolfram != 110 || rule.States != 2 {
+		t.Fatalf("parsed to unexpected rule %+v", rule)
+	}
+
+	options := Options{Width: 40, Height: 10, Rule: rule}
+
+	if err := Check(GRID, options); err == nil {
+		t.Errorf("grid engine accepted an elementary rule")
+	}
+
+	if err := Check(ELEMENTARY, Options{Rule: parseRule(t, "B3/S23")}); err == nil {
+		t.Errorf("elementary engine accepted a life rule")
+	}
+
+	for _, definition := range []string{"W30", "W90", "W110", "W105"} {
+		for _, wrap := range []bool{false, true} {
+			options := Options{Width: 40, Height: 10, Wrap: wrap, Rule: parseRule(t, definition)}
+
+			universe, err := New(ELEMENTARY, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			random := rand.New(rand.NewSource(5))
+			history := [][]uint8{make([]uint8, options.Width)}
+
+			for x := range history[0] {
+				if random.Intn(3) == 0 {
+					history[0][x] = Alive
+					universe.Set(x, 0, Alive)
+				}
+			}
+
+			// more generations than rows, so the universe scrolls
+			for generation := 0; generation < 25; generation++ {
+				current := history[len(history)-1]
+				next := make([]uint8, options.Width)
+
+				for x := range next {
+					var pattern int
+
+					for _, offset := range []int{-1, 0, 1} {
+						pattern <<= 1
+
+						neighbor := x + offset
+						if wrap {
+							neighbor = (neighbor + options.Width) % options.Width
+						}
+
+						if neighbor >= 0 && neighbor < options.Width && current[neighbor] == Alive {
+							pattern |= 1
+						}
+					}
+
+					next[x] = uint8(options.Rule.Wolfram>>pattern) & 1
+				}
+
+				history = append(history, next)
+			}
+
+			universe.Step(25)
+
+			visible := history[len(history)-options.Height:]
+			for y, row := range visible {
+				for x, state := range row {
+					if universe.Get(x, y) != state {
+						t.Fatalf("%s wrap %t: cell %d,%d differs", definition, wrap, x, y)
+					}
+				}
+			}
+
+			if universe.Generation() != 25 {
+				t.Errorf("%s: unexpected generation %d", definition, universe.Generation())
+			}
+		}
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for _, named := range RULES {
+		rule := parseRule(t, named.Name)
+		if rule.Name != named.Name || rule.Definition != named.Definition {
+			t.Errorf("%s: parsed to unexpected rule %+v", named.Name, rule)
+		}
+	}
+
+	tests := map[string]string{
+		"highlife":           "B36/S23",
+		"Day & Night":        "B3678/S34678",
+		"seeds:T40,30":       "B2/S:T40,30",
+		"Brian's Brain":      "B2/S/C3",
+		"B36/S23":            "B36/S23",
+		"life-without-death": "B3/S012345678",
+	}
+
+	for name, expect := range tests {
+		if rule := parseRule(t, name); rule.Definition != expect {
+			t.Errorf("%s: expected %s, got %s", name, expect, rule.Definition)
+		}
+	}
+
+	if rule := parseRule(t, "B36/S23"); rule.Name != "" {
+		t.Errorf("rule given by definition got a name: %s", rule.Name)
+	}
+}
+
+func TestParseRule(t *testing.T) {
+	tests := map[string]string{
+		"B3/S23":                      "B3/S23",
+		"b3/s23":                      "B3/S23",
+		"S23/B3":                      "B3/S23",
+		"23/3":                        "B3/S23",
+		"/2":                          "B2/S",
+		"B63/S32":                     "B36/S23",
+		"345/2/4":                     "B2/S345/C4",
+		"b2/s/c3":                     "B2/S/C3",
+		"B2/S34h":                     "B2/S34H",
+		"B13/S012v":                   "B13/S012V",
+		"B2/S/C3V":                    "B2/S/C3V",
+		"B2/S/C4H":                    "B2/S/C4H",
+		"B3cekainyqjr/S2-c3":          "B3/S2-c3",
+		"B2aceikn/S2-ckn3cekain":      "B2/S2eai3-yqjr",
+		"r5,c0,m1,s34..58,b34..45,nm": "R5,C0,M1,S34..58,B34..45,NM",
+		"w110":                        "W110",
+		"B3/S23:t50":                  "B3/S23:T50,50",
+		"B3/S23:k40,30*":              "B3/S23:K40,30*",
+		"B3/S23:S40":                  "B3/S23:S40",
+		"Life:T":                      "B3/S23:T",
+	}
+
+	for definition, expect := range tests {
+		rule := parseRule(t, definition)
+		if rule.Definition != expect {
+			t.Errorf("%s: expected %s, got %s", definition, expect, rule.Definition)
+		}
+
+		// the canonical form parses to the same rule
+		again := parseRule(t, rule.Definition)
+		again.Name = rule.Name
+
+		if !reflect.DeepEqual(again, rule) {
+			t.Errorf("%s: canonical form %s parses to a different rule", definition, rule.Definition)
+		}
+	}
+
+	// every neighborhood suffix survives the canonical form
+	for _, definition := range []string{"B3/S23", "B2/S34H", "B13/S012V", "B2/S/C3V", "B2/S/C4H"} {
+		rule := parseRule(t, definition)
+
+		again, err := ParseGameRule(rule.Canonical())
+		if err != nil {
+			t.Errorf("%s: canonical form %s does not parse: %s", definition, rule.Canonical(), err)
+			continue
+		}
+
+		if again.Neighborhood != rule.Neighborhood {
+			t.Errorf("%s: canonical form %s has a different neighborhood", definition, rule.Canonical())
+		}
+	}
+
+	invalid := []string{
+		"", "B3", "B3/S23/C1", "B9/S23", "B3/S23/S4", "23/3/x", "B3/X23", "B3/S23:X",
+		"B3/S23:K40,30", "B3/S23:S40,30", "B2a/S12H", "B5/S1V", "R0,C0,M1,S1..2,B1..2,NM",
+		"W256", "B3-/S23", "B3x/S23", "R5,C0,M1,S34..58,NM", "R5,C0,M1,B34..45,NM", "R5,C0,M1",
+		"C0,M1,S34..58,B34..45,NM",
+	}
+
+	for _, definition := range invalid {
+		if _, err := ParseGameRule(definition); err == nil {
+			t.Errorf("invalid rule %s accepted", definition)
+		}
+	}
+}
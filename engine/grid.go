@@ -0,0 +1,468 @@
+package engine
+
+import (
+	"image"
+	"sync"
+)
+
+// The Grid is a flat, bounded  universe with one byte per cell, which
+// uses a double buffer: one holds the current generation, the other one
+// the next.
+//
+// The grid is divided into tiles of TILE_SIZE x TILE_SIZE cells, for
+// each tile  we keep  track of  wether any  cell changed  during the
+// last generation. Only  tiles whose neighborhood changed are evaluated.
+// All  other  tiles already contain  the  correct  state  in the  next
+// buffer, since it still holds the generation before the current one,
+// which is identical in those regions.
+type Grid struct {
+	Width, Height int
+	Wrap          bool
+	Topology      Topology   // how the edges are joined in wrap mode
+	Data          [2][]uint8 // double buffer, Index points to the current generation
+	Changed       [2][]bool  // per buffer and tile: true if a cell changed
+	Index         int
+	Ages          []int64 // generation of the last state change per cell
+	TilesX        int     // number of tiles per row
+	TilesY        int     // number of tile rows
+
+	rulecheck  func(uint8, uint8) uint8
+	counter    func(data []uint8, x, y int) uint8
+	ltl        *Rule      // Larger than Life rules are computed separately
+	table      *RuleTable // so are rules loaded from rule files
+	strobe     Strobe     // phase of B0 rules, see strobe.go
+	sat        []int32    // summed-area table used by Larger than Life
+	generation int64
+	active     int
+}
+
+// Create new empty grid and allocate Data according to provided dimensions
+func NewGrid(options Options) *Grid {
+	size := options.Width * options.Height
+
+	grid := &Grid{
+		Width:    options.Width,
+		Height:   options.Height,
+		Wrap:     options.Wrap,
+		Topology: options.Topology,
+		Data:     [2][]uint8{make([]uint8, size), make([]uint8, size)},
+		Ages:     make([]int64, size),
+	}
+
+	grid.SetupTiles()
+	grid.SetRule(options.Rule)
+
+	return grid
+}
+
+func (grid *Grid) SetRule(rule *Rule) {
+	grid.strobe.SetRule(rule)
+	grid.rulecheck = rule.CheckFunc()
+
+	grid.ltl = nil
+	if rule.IsLargerThanLife() {
+		grid.ltl = rule
+	}
+
+	grid.table = rule.Table
+
+	switch {
+	case rule.NonTotalistic:
+		// the rule needs the exact configuration of the neighbors
+		grid.counter = grid.CountNeighborhood
+	case rule.IsGenerations():
+		// dying cells must not be counted
+		grid.counter = grid.CountNeighborsStates
+	case grid.Wrap && grid.Topology.Twisted():
+		// knows about twisted edges
+		grid.counter = grid.CountNeighborsStates
+	case grid.Wrap:
+		grid.counter = grid.CountNeighborsWrap
+	default:
+		grid.counter = grid.CountNeighbors
+	}
+
+	// everything has to be re-evaluated using the new rule
+	grid.MarkAllChanged()
+}
+
+// Initially all tiles are marked as changed, so that everything is
+// being evaluated at least once.
+func (grid *Grid) SetupTiles() {
+	grid.TilesX = (grid.Width + TILE_MASK) >> TILE_SHIFT
+	grid.TilesY = (grid.Height + TILE_MASK) >> TILE_SHIFT
+
+	for idx := range grid.Changed {
+		grid.Changed[idx] = make([]bool, grid.TilesX*grid.TilesY)
+	}
+
+	grid.MarkAllChanged()
+}
+
+func (grid *Grid) MarkAllChanged() {
+	for idx := range grid.Changed[grid.Index] {
+		grid.Changed[grid.Index][idx] = true
+	}
+}
+
+// mark the tile containing the given cell as changed
+func (grid *Grid) MarkChanged(x, y int) {
+	grid.Changed[grid.Index][(y>>TILE_SHIFT)*grid.TilesX+(x>>TILE_SHIFT)] = true
+}
+
+func (grid *Grid) Inside(x, y int) bool {
+	return x >= 0 && y >= 0 && x < grid.Width && y < grid.Height
+}
+
+func (grid *Grid) Get(x, y int) uint8 {
+	if !grid.Inside(x, y) {
+		return Dead
+	}
+
+	return grid.Data[grid.Index][y*grid.Width+x]
+}
+
+func (grid *Grid) Set(x, y int, state uint8) {
+	if !grid.Inside(x, y) {
+		return
+	}
+
+	grid.Data[grid.Index][y*grid.Width+x] = state
+	grid.Ages[y*grid.Width+x] = 0
+	grid.MarkChanged(x, y)
+}
+
+// call action for every non-dead cell inside rect
+func (grid *Grid) Each(rect image.Rectangle, action func(x, y int)) {
+	rect = rect.Intersect(image.Rect(0, 0, grid.Width, grid.Height))
+	data := grid.Data[grid.Index]
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if data[y*grid.Width+x] != Dead {
+				action(x, y)
+			}
+		}
+	}
+}
+
+// return the bounding box of all non-dead cells
+func (grid *Grid) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	grid.Each(image.Rect(0, 0, grid.Width, grid.Height), func(x, y int) {
+		bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+	})
+
+	return bounds
+}
+
+func (grid *Grid) Population() int64 {
+	var population int64
+
+	for _, state := range grid.Data[grid.Index] {
+		if state != Dead {
+			population++
+		}
+	}
+
+	return population
+}
+
+func (grid *Grid) Generation() int64 {
+	return grid.generation
+}
+
+func (grid *Grid) Age(x, y int) int64 {
+	if !grid.Inside(x, y) {
+		return 0
+	}
+
+	return grid.Ages[y*grid.Width+x]
+}
+
+func (grid *Grid) ActiveCells() int {
+	return grid.active
+}
+
+func (grid *Grid) Inverted() bool {
+	return grid.strobe.Inverted
+}
+
+func (grid *Grid) SetInverted(inverted bool) {
+	grid.strobe.Inverted = inverted
+}
+
+// return the cell at the given position, which may be outside the grid,
+// false if there is none
+func (grid *Grid) Neighbor(x, y int) (int, int, bool) {
+	if grid.Inside(x, y) {
+		return x, y, true
+	}
+
+	if !grid.Wrap {
+		return 0, 0, false
+	}
+
+	return grid.Topology.Map(x, y, grid.Width, grid.Height)
+}
+
+func (grid *Grid) CountNeighborsWrap(data []uint8, x, y int) uint8 {
+	var sum uint8
+
+	for nbgX := -1; nbgX < 2; nbgX++ {
+		for nbgY := -1; nbgY < 2; nbgY++ {
+			var col, row int
+
+			// In wrap mode we look at all the 8 neighbors surrounding us.
+			// In case we are on an edge we'll look at the neighbor on the
+			//  other side  of the  grid, thus  wrapping lookahead  around
+			// using the mod() function.
+			col = (x + nbgX + grid.Width) % grid.Width
+			row = (y + nbgY + grid.Height) % grid.Height
+
+			sum += data[row*grid.Width+col]
+		}
+	}
+
+	// don't count ourselfes though
+	sum -= data[y*grid.Width+x]
+
+	return sum
+}
+
+func (grid *Grid) CountNeighbors(data []uint8, x, y int) uint8 {
+	var sum uint8
+
+	width := grid.Width
+	height := grid.Height
+
+	for nbgX := -1; nbgX < 2; nbgX++ {
+		for nbgY := -1; nbgY < 2; nbgY++ {
+			xnbgX := x + nbgX
+			ynbgY := y + nbgY
+
+			// In traditional grid mode the edges are deadly
+			if xnbgX < 0 || xnbgX >= width || ynbgY < 0 || ynbgY >= height {
+				continue
+			}
+
+			sum += data[ynbgY*width+xnbgX]
+		}
+	}
+
+	// don't count ourselfes though
+	sum -= data[y*width+x]
+
+	return sum
+}
+
+// count the life neighbors only, cells may have other states as well
+func (grid *Grid) CountNeighborsStates(data []uint8, x, y int) uint8 {
+	var sum uint8
+
+	for nbgX := -1; nbgX < 2; nbgX++ {
+		for nbgY := -1; nbgY < 2; nbgY++ {
+			if nbgX == 0 && nbgY == 0 {
+				continue
+			}
+
+			col, row, ok := grid.Neighbor(x+nbgX, y+nbgY)
+			if ok && data[row*grid.Width+col] == Alive {
+				sum++
+			}
+		}
+	}
+
+	return sum
+}
+
+// fill in the states of all neighbors of a cell, see NEIGHBORHOOD for
+// the order
+func (grid *Grid) Neighborhood(data []uint8, x, y int, states *[8]uint8) {
+	for idx, offset := range NEIGHBORHOOD {
+		col, row, ok := grid.Neighbor(x+offset.X, y+offset.Y)
+
+		states[idx] = Dead
+		if ok {
+			states[idx] = data[row*grid.Width+col]
+		}
+	}
+}
+
+// return the  neighborhood mask of a  cell, see NEIGHBORHOOD for the
+// meaning of the bits
+func (grid *Grid) CountNeighborhood(data []uint8, x, y int) uint8 {
+	var mask uint8
+
+	for bit, offset := range NEIGHBORHOOD {
+		col, row, ok := grid.Neighbor(x+offset.X, y+offset.Y)
+		if ok && data[row*grid.Width+col] == Alive {
+			mask |= 1 << bit
+		}
+	}
+
+	return mask
+}
+
+// return the cell area covered by a tile
+func (grid *Grid) TileRect(tile int) image.Rectangle {
+	x := (tile % grid.TilesX) * TILE_SIZE
+	y := (tile / grid.TilesX) * TILE_SIZE
+
+	return image.Rect(x, y, x+TILE_SIZE, y+TILE_SIZE).Intersect(
+		image.Rect(0, 0, grid.Width, grid.Height))
+}
+
+// return all tiles which themselfes or one of their neighbor tiles
+// changed during the last generation, only those need to be evaluated.
+//
+// If the rule  alternates between generations, a tile  only stays the
+// same if its neighborhood didn't change  during the last two of them,
+// the next buffer then contains the state computed with the same rule.
+func (grid *Grid) ActiveTiles(alternating bool) []int {
+	active := []int{}
+
+	for tileY := 0; tileY < grid.TilesY; tileY++ {
+		for tileX := 0; tileX < grid.TilesX; tileX++ {
+			if grid.TileNeighborhoodChanged(grid.Changed[grid.Index], tileX, tileY) ||
+				(alternating && grid.TileNeighborhoodChanged(grid.Changed[grid.Index^1], tileX, tileY)) ||
+				grid.TwistedEdge(tileX, tileY) {
+				active = append(active, tileY*grid.TilesX+tileX)
+			}
+		}
+	}
+
+	return active
+}
+
+// tiles on twisted edges have neighbors anywhere on the other side of
+// the grid, we don't keep track of them and evaluate those tiles always
+func (grid *Grid) TwistedEdge(tileX, tileY int) bool {
+	return grid.Wrap && grid.Topology.Twisted() &&
+		(tileX == 0 || tileY == 0 || tileX == grid.TilesX-1 || tileY == grid.TilesY-1)
+}
+
+func (grid *Grid) TileNeighborhoodChanged(changed []bool, tileX, tileY int) bool {
+	for nbgY := -1; nbgY < 2; nbgY++ {
+		for nbgX := -1; nbgX < 2; nbgX++ {
+			col := tileX + nbgX
+			row := tileY + nbgY
+
+			if grid.Wrap {
+				// cells on the edges look at the other side of the grid
+				col = (col + grid.TilesX) % grid.TilesX
+				row = (row + grid.TilesY) % grid.TilesY
+			} else if col < 0 || col >= grid.TilesX || row < 0 || row >= grid.TilesY {
+				continue
+			}
+
+			if changed[row*grid.TilesX+col] {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func (grid *Grid) Step(generations int64) {
+	for ; generations > 0; generations-- {
+		grid.StepOnce()
+	}
+}
+
+// Update all cells according to the current rule
+func (grid *Grid) StepOnce() {
+	// next grid index, we just xor 0|1 to 1|0
+	next := grid.Index ^ 1
+
+	alternating := grid.strobe.Active()
+	if alternating {
+		grid.rulecheck = grid.strobe.Next().CheckFunc()
+	}
+
+	if grid.ltl != nil {
+		grid.StepLargerThanLife(next)
+	} else {
+		grid.StepTiles(next, alternating)
+	}
+
+	// switch grid for rendering
+	grid.Index = next
+
+	// global stats counter
+	grid.generation++
+}
+
+// compute the next generation, one goroutine per active tile
+func (grid *Grid) StepTiles(next int, alternating bool) {
+	active := grid.ActiveTiles(alternating)
+
+	// tiles which will not be evaluated don't change
+	clear(grid.Changed[next])
+
+	var wg sync.WaitGroup
+	wg.Add(len(active))
+
+	for _, tile := range active {
+		go func() {
+			defer wg.Done()
+
+			grid.Changed[next][tile] = grid.StepTile(tile)
+		}()
+	}
+
+	wg.Wait()
+
+	grid.active = 0
+	for _, tile := range active {
+		rect := grid.TileRect(tile)
+		grid.active += rect.Dx() * rect.Dy()
+	}
+}
+
+// compute the cells of one tile, returns true if any cell changed
+func (grid *Grid) StepTile(tile int) bool {
+	changed := false
+	rect := grid.TileRect(tile)
+
+	current := grid.Data[grid.Index]
+	next := grid.Data[grid.Index^1]
+
+	var neighborhood [8]uint8
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			idx := y*grid.Width + x
+
+			state := current[idx] // 0|1 == dead or alive
+
+			var nextstate uint8
+
+			if grid.table != nil {
+				// rule files need the states of all neighbors
+				grid.Neighborhood(current, x, y, &neighborhood)
+				nextstate = grid.table.Next(state, &neighborhood)
+			} else {
+				neighbors := grid.counter(current, x, y)
+
+				// actually apply the current rules
+				nextstate = grid.rulecheck(state, neighbors)
+			}
+
+			// change state of current cell in next grid
+			next[idx] = nextstate
+
+			if state != nextstate {
+				changed = true
+
+				// remember the  generation in  which the  cell changed,
+				// the UI uses it to draw evolution traces
+				grid.Ages[idx] = grid.generation + 1
+			}
+		}
+	}
+
+	return changed
+}
@@ -0,0 +1,433 @@
+package engine
+
+import "image"
+
+// HashLife  engine,   see  https://en.wikipedia.org/wiki/Hashlife  and
+// Gosper: "Exploiting Regularities in Large Cellular Spaces" (1984).
+//
+// The universe is stored as  a quadtree of canonical nodes: identical
+// regions are represented by the  very same node. Every node memoizes
+// its  successor, which  is  the  center of  the  node 2^j  generations
+// ahead. Since  a result once  computed is reused everywhere  the same
+// region  appears, regular  patterns like  guns and  breeders can  be
+// advanced millions of generations in a couple of steps.
+//
+// The HashLife universe is unbounded. Step() advances the universe in
+// powers of two, so large step sizes are very cheap.
+
+const (
+	// when that many canonical nodes exist, the caches will be rebuilt
+	HASHLIFE_MAX_NODES = 1 << 21
+
+	// smallest level used for the root node, 8x8 cells
+	HASHLIFE_MIN_LEVEL = 3
+)
+
+type Node struct {
+	NW, NE, SW, SE *Node
+	Level          uint  // the node covers 2^Level x 2^Level cells
+	Population     int64 // number of life cells in the node
+}
+
+type nodeKey struct {
+	nw, ne, sw, se *Node
+}
+
+type resultKey struct {
+	node *Node
+	step uint
+}
+
+type HashLife struct {
+	Root             *Node
+	OriginX, OriginY int // world position of the top left corner of Root
+
+	generation int64
+	on, off    *Node
+	empty      []*Node             // cache of empty nodes per level
+	nodes      map[nodeKey]*Node   // canonical nodes
+	results    map[resultKey]*Node // memoized successors
+	leaves     []*Node             // successors of all 4x4 nodes, index is the cell mask
+}
+
+// Create a new HashLife  engine. The rule check func is  the one also
+// used by the flat grid stepper, it is only used once here to compute
+// the outcome of all possible 4x4 cell blocks.
+func NewHashLife(options Options) *HashLife {
+	hashlife := &HashLife{
+		on:  &Node{Population: 1},
+		off: &Node{},
+	}
+
+	hashlife.Reset()
+	hashlife.SetupLeaves(options.Rule)
+
+	hashlife.Root = hashlife.Empty(HASHLIFE_MIN_LEVEL)
+
+	return hashlife
+}
+
+// all memoized results depend on the rule, so start over with the
+// current universe
+func (hashlife *HashLife) SetRule(rule *Rule) {
+	hashlife.Reset()
+	hashlife.SetupLeaves(rule)
+	hashlife.Root = hashlife.Intern(hashlife.Root)
+}
+
+func (hashlife *HashLife) Generation() int64 {
+	return hashlife.generation
+}
+
+func (hashlife *HashLife) Population() int64 {
+	return hashlife.Root.Population
+}
+
+// clear all caches
+func (hashlife *HashLife) Reset() {
+	hashlife.nodes = make(map[nodeKey]*Node)
+	hashlife.results = make(map[resultKey]*Node)
+	hashlife.empty = []*Node{hashlife.off}
+}
+
+// pre-compute the  next generation of  the center 2x2 cells  of every
+// possible 4x4 block, which is the base case of the recursion
+func (hashlife *HashLife) SetupLeaves(rule *Rule) {
+	hashlife.leaves = make([]*Node, 1<<16)
+	rulecheck := rule.CheckFunc()
+
+	cell := func(mask, x, y int) uint8 {
+		return uint8((mask >> (y*4 + x)) & 1)
+	}
+
+	for mask := 0; mask < len(hashlife.leaves); mask++ {
+		next := [4]*Node{}
+
+		for idx, pos := range [][]int{{1, 1}, {2, 1}, {1, 2}, {2, 2}} {
+			var neighbors uint8
+
+			for bit, offset := range NEIGHBORHOOD {
+				if rule.NonTotalistic {
+					neighbors |= cell(mask, pos[0]+offset.X, pos[1]+offset.Y) << bit
+				} else {
+					neighbors += cell(mask, pos[0]+offset.X, pos[1]+offset.Y)
+				}
+			}
+
+			next[idx] = hashlife.off
+			if rulecheck(cell(mask, pos[0], pos[1]), neighbors) == Alive {
+				next[idx] = hashlife.on
+			}
+		}
+
+		hashlife.leaves[mask] = hashlife.Join(next[0], next[1], next[2], next[3])
+	}
+}
+
+// return the canonical node made of the given quadrants
+func (hashlife *HashLife) Join(nw, ne, sw, se *Node) *Node {
+	key := nodeKey{nw, ne, sw, se}
+
+	if node, ok := hashlife.nodes[key]; ok {
+		return node
+	}
+
+	node := &Node{
+		NW: nw, NE: ne, SW: sw, SE: se,
+		Level:      nw.Level + 1,
+		Population: nw.Population + ne.Population + sw.Population + se.Population,
+	}
+
+	hashlife.nodes[key] = node
+
+	return node
+}
+
+// return an empty node of the given level
+func (hashlife *HashLife) Empty(level uint) *Node {
+	for uint(len(hashlife.empty)) <= level {
+		previous := hashlife.empty[len(hashlife.empty)-1]
+		hashlife.empty = append(hashlife.empty,
+			hashlife.Join(previous, previous, previous, previous))
+	}
+
+	return hashlife.empty[level]
+}
+
+// return a node one level larger with the given node in its center
+func (hashlife *HashLife) Centre(node *Node) *Node {
+	border := hashlife.Empty(node.Level - 1)
+
+	return hashlife.Join(
+		hashlife.Join(border, border, border, node.NW),
+		hashlife.Join(border, border, node.NE, border),
+		hashlife.Join(border, node.SW, border, border),
+		hashlife.Join(node.SE, border, border, border),
+	)
+}
+
+// compute the  center of  the node  2^step generations  ahead. Results
+// are memoized. The step must not be larger than node.Level-2
+func (hashlife *HashLife) Successor(node *Node, step uint) *Node {
+	if node.Population == 0 {
+		return hashlife.Empty(node.Level - 1)
+	}
+
+	if node.Level == 2 {
+		return hashlife.leaves[hashlife.Mask(node)]
+	}
+
+	if step > node.Level-2 {
+		step = node.Level - 2
+	}
+
+	key := resultKey{node, step}
+	if result, ok := hashlife.results[key]; ok {
+		return result
+	}
+
+	nw, ne, sw, se := node.NW, node.NE, node.SW, node.SE
+
+	// the 9 overlapping sub nodes one level below
+	c1 := hashlife.Successor(nw, step)
+	c2 := hashlife.Successor(hashlife.Join(nw.NE, ne.NW, nw.SE, ne.SW), step)
+	c3 := hashlife.Successor(ne, step)
+	c4 := hashlife.Successor(hashlife.Join(nw.SW, nw.SE, sw.NW, sw.NE), step)
+	c5 := hashlife.Successor(hashlife.Join(nw.SE, ne.SW, sw.NE, se.NW), step)
+	c6 := hashlife.Successor(hashlife.Join(ne.SW, ne.SE, se.NW, se.NE), step)
+	c7 := hashlife.Successor(sw, step)
+	c8 := hashlife.Successor(hashlife.Join(sw.NE, se.NW, sw.SE, se.SW), step)
+	c9 := hashlife.Successor(se, step)
+
+	var result *Node
+
+	if step < node.Level-2 {
+		// the sub nodes are already far enough ahead, just assemble
+		// the center from them
+		result = hashlife.Join(
+			hashlife.Join(c1.SE, c2.SW, c4.NE, c5.NW),
+			hashlife.Join(c2.SE, c3.SW, c5.NE, c6.NW),
+			hashlife.Join(c4.SE, c5.SW, c7.NE, c8.NW),
+			hashlife.Join(c5.SE, c6.SW, c8.NE, c9.NW),
+		)
+	} else {
+		// advance the same amount of generations again
+		result = hashlife.Join(
+			hashlife.Successor(hashlife.Join(c1, c2, c4, c5), step),
+			hashlife.Successor(hashlife.Join(c2, c3, c5, c6), step),
+			hashlife.Successor(hashlife.Join(c4, c5, c7, c8), step),
+			hashlife.Successor(hashlife.Join(c5, c6, c8, c9), step),
+		)
+	}
+
+	hashlife.results[key] = result
+
+	return result
+}
+
+// turn a 4x4 node into a bit mask, bit 0 is the top left cell
+func (hashlife *HashLife) Mask(node *Node) int {
+	mask := 0
+
+	for idx, quadrant := range []*Node{node.NW, node.NE, node.SW, node.SE} {
+		offX := (idx % 2) * 2
+		offY := (idx / 2) * 2
+
+		for cidx, cell := range []*Node{quadrant.NW, quadrant.NE, quadrant.SW, quadrant.SE} {
+			if cell.Population > 0 {
+				mask |= 1 << ((offY+cidx/2)*4 + offX + cidx%2)
+			}
+		}
+	}
+
+	return mask
+}
+
+// true if all life cells are inside the innermost quarter of the root
+func (hashlife *HashLife) Contained() bool {
+	root := hashlife.Root
+
+	return root.NW.Population == root.NW.SE.SE.Population &&
+		root.NE.Population == root.NE.SW.SW.Population &&
+		root.SW.Population == root.SW.NE.NE.Population &&
+		root.SE.Population == root.SE.NW.NW.Population
+}
+
+// double the size of the root node, keeping the content centered
+func (hashlife *HashLife) Expand() {
+	half := 1 << (hashlife.Root.Level - 1)
+
+	hashlife.Root = hashlife.Centre(hashlife.Root)
+	hashlife.OriginX -= half
+	hashlife.OriginY -= half
+}
+
+// advance the universe by the given number of generations, which is
+// split up into powers of two
+func (hashlife *HashLife) Step(generations int64) {
+	for steplog := uint(0); generations > 0; steplog++ {
+		if generations&1 == 1 {
+			hashlife.Advance(steplog)
+		}
+
+		generations >>= 1
+	}
+}
+
+// advance the universe by 2^steplog generations
+func (hashlife *HashLife) Advance(steplog uint) {
+	// the pattern  can grow  by one  cell per  generation in  every
+	// direction, make sure there is enough room for it
+	for hashlife.Root.Level < steplog+3 || !hashlife.Contained() {
+		hashlife.Expand()
+	}
+
+	quarter := 1 << (hashlife.Root.Level - 2)
+
+	hashlife.Root = hashlife.Successor(hashlife.Root, steplog)
+	hashlife.OriginX += quarter
+	hashlife.OriginY += quarter
+	hashlife.generation += 1 << steplog
+
+	if len(hashlife.nodes) > HASHLIFE_MAX_NODES {
+		hashlife.Collect()
+	}
+}
+
+// drop  all caches and  only keep the  nodes still in  use by the root
+func (hashlife *HashLife) Collect() {
+	hashlife.Reset()
+
+	for idx, leaf := range hashlife.leaves {
+		hashlife.leaves[idx] = hashlife.Intern(leaf)
+	}
+
+	hashlife.Root = hashlife.Intern(hashlife.Root)
+}
+
+// re-create the given node in the current canonical node table
+func (hashlife *HashLife) Intern(node *Node) *Node {
+	if node.Level == 0 {
+		return node
+	}
+
+	if node.Population == 0 {
+		return hashlife.Empty(node.Level)
+	}
+
+	return hashlife.Join(
+		hashlife.Intern(node.NW),
+		hashlife.Intern(node.NE),
+		hashlife.Intern(node.SW),
+		hashlife.Intern(node.SE),
+	)
+}
+
+func (hashlife *HashLife) Get(x, y int) uint8 {
+	node := hashlife.Root
+	x -= hashlife.OriginX
+	y -= hashlife.OriginY
+
+	size := 1 << node.Level
+	if x < 0 || y < 0 || x >= size || y >= size {
+		return Dead
+	}
+
+	for node.Level > 0 && node.Population > 0 {
+		half := 1 << (node.Level - 1)
+
+		switch {
+		case x < half && y < half:
+			node = node.NW
+		case y < half:
+			node, x = node.NE, x-half
+		case x < half:
+			node, y = node.SW, y-half
+		default:
+			node, x, y = node.SE, x-half, y-half
+		}
+	}
+
+	if node.Population > 0 {
+		return Alive
+	}
+
+	return Dead
+}
+
+func (hashlife *HashLife) Set(x, y int, state uint8) {
+	// grow the universe until the cell is inside
+	for x < hashlife.OriginX || y < hashlife.OriginY ||
+		x >= hashlife.OriginX+1<<hashlife.Root.Level ||
+		y >= hashlife.OriginY+1<<hashlife.Root.Level {
+		hashlife.Expand()
+	}
+
+	hashlife.Root = hashlife.SetCell(hashlife.Root, x-hashlife.OriginX, y-hashlife.OriginY, state)
+}
+
+// return a copy of the node with the given cell modified
+func (hashlife *HashLife) SetCell(node *Node, x, y int, state uint8) *Node {
+	if node.Level == 0 {
+		if state == Alive {
+			return hashlife.on
+		}
+
+		return hashlife.off
+	}
+
+	half := 1 << (node.Level - 1)
+	nw, ne, sw, se := node.NW, node.NE, node.SW, node.SE
+
+	switch {
+	case x < half && y < half:
+		nw = hashlife.SetCell(nw, x, y, state)
+	case y < half:
+		ne = hashlife.SetCell(ne, x-half, y, state)
+	case x < half:
+		sw = hashlife.SetCell(sw, x, y-half, state)
+	default:
+		se = hashlife.SetCell(se, x-half, y-half, state)
+	}
+
+	return hashlife.Join(nw, ne, sw, se)
+}
+
+// call action for every life cell inside rect
+func (hashlife *HashLife) Each(rect image.Rectangle, action func(x, y int)) {
+	hashlife.Visit(hashlife.Root, hashlife.OriginX, hashlife.OriginY, rect, action)
+}
+
+func (hashlife *HashLife) Visit(node *Node, x, y int, rect image.Rectangle, action func(x, y int)) {
+	size := 1 << node.Level
+
+	if node.Population == 0 || !image.Rect(x, y, x+size, y+size).Overlaps(rect) {
+		return
+	}
+
+	if node.Level == 0 {
+		action(x, y)
+		return
+	}
+
+	half := size / 2
+
+	hashlife.Visit(node.NW, x, y, rect, action)
+	hashlife.Visit(node.NE, x+half, y, rect, action)
+	hashlife.Visit(node.SW, x, y+half, rect, action)
+	hashlife.Visit(node.SE, x+half, y+half, rect, action)
+}
+
+// return the bounding box of all life cells
+func (hashlife *HashLife) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	size := 1 << hashlife.Root.Level
+	all := image.Rect(0, 0, size, size).Add(image.Point{X: hashlife.OriginX, Y: hashlife.OriginY})
+
+	hashlife.Each(all, func(x, y int) {
+		bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+	})
+
+	return bounds
+}
@@ -0,0 +1,209 @@
+package engine
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// Isotropic  non-totalistic rules  using  Hensel  notation, see
+// https://conwaylife.com/wiki/Isotropic_non-totalistic_rule
+//
+// Such rules  don't just  look at the  number of  life neighbors, but
+// also at their exact configuration. A neighbor count may be followed
+// by letters selecting  configurations: B2a means born with  2 life
+// neighbors only if they are adjacent,  B2-a means all configurations
+// except  that one.  The engines  compute  a  neighborhood mask  instead
+// of the count, the rule then is just a table lookup.
+
+// neighbor positions, the  index is the bit in  the neighborhood mask:
+// N, NE, E, SE, S, SW, W, NW
+var NEIGHBORHOOD = [8]image.Point{
+	{X: 0, Y: -1}, {X: 1, Y: -1}, {X: 1, Y: 0}, {X: 1, Y: 1},
+	{X: 0, Y: 1}, {X: -1, Y: 1}, {X: -1, Y: 0}, {X: -1, Y: -1},
+}
+
+const (
+	N = 1 << iota
+	NE
+	E
+	SE
+	S
+	SW
+	W
+	NW
+)
+
+// the letters in canonical order,  counts with fewer configurations
+// only use the first ones
+const HENSEL_LETTERS = "cekainyqjrtwz"
+
+// one example configuration per letter,  all the others are derived by
+// rotation and reflection. Counts above 4 use the complement of 8-n.
+var HENSEL = map[int]map[byte]uint8{
+	1: {'c': NE, 'e': N},
+	2: {
+		'c': NE | SE, 'e': N | E, 'k': N | SE,
+		'a': N | NE, 'i': N | S, 'n': NE | SW,
+	},
+	3: {
+		'c': NE | SE | SW, 'e': N | E | S, 'k': N | E | SW,
+		'a': N | NE | E, 'i': NW | N | NE, 'n': N | NE | SE,
+		'y': N | SE | SW, 'q': N | NE | SW, 'j': N | NE | W, 'r': N | NE | S,
+	},
+	4: {
+		'c': NE | SE | SW | NW, 'e': N | E | S | W, 'k': N | NE | SE | W,
+		'a': N | NE | E | SE, 'i': N | NE | SE | S, 'n': N | NE | SE | NW,
+		'y': N | NE | SE | SW, 'q': N | NE | E | SW, 'j': N | NE | S | W,
+		'r': N | NE | E | S, 't': N | SE | S | SW, 'w': N | NE | SW | W,
+		'z': N | NE | S | SW,
+	},
+}
+
+// return all  neighborhood masks matching the given letter  for n life
+// neighbors, false if the letter doesn't exist for that count
+func HenselMasks(count int, letter byte) ([]uint8, bool) {
+	complement := count > 4
+	if complement {
+		count = 8 - count
+	}
+
+	mask, ok := HENSEL[count][letter]
+	if !ok {
+		return nil, false
+	}
+
+	if complement {
+		mask = ^mask
+	}
+
+	masks := []uint8{}
+
+	// 4 rotations, each one also mirrored
+	for rotation := 0; rotation < 4; rotation++ {
+		for _, variant := range []uint8{mask, Mirror(mask)} {
+			if !slices.Contains(masks, variant) {
+				masks = append(masks, variant)
+			}
+		}
+
+		mask = bits.RotateLeft8(mask, 2)
+	}
+
+	return masks, true
+}
+
+// mirror a neighborhood mask on the vertical axis
+func Mirror(mask uint8) uint8 {
+	var mirrored uint8
+
+	for bit := 0; bit < 8; bit++ {
+		if mask&(1<<bit) != 0 {
+			mirrored |= 1 << ((8 - bit) % 8)
+		}
+	}
+
+	return mirrored
+}
+
+// parse one part of a rule like 2-a or 3aeijr4 into a table indexed by
+// neighborhood mask. Plain counts  select all configurations. Returns
+// the counts mentioned and wether letters have been used.
+func ParseConditions(rule, conditions string) ([]uint8, [256]bool, bool, error) {
+	var (
+		table   [256]bool
+		letters bool
+	)
+
+	counts := []uint8{}
+
+	for idx := 0; idx < len(conditions); {
+		char := conditions[idx]
+		if char < '0' || char > '8' {
+			return nil, table, false, fmt.Errorf("invalid game rule part <%s> in <%s>", conditions, rule)
+		}
+
+		count := int(char - '0')
+		counts = append(counts, uint8(count))
+		idx++
+
+		negate := idx < len(conditions) && conditions[idx] == '-'
+		if negate {
+			idx++
+		}
+
+		start := idx
+		for idx < len(conditions) && conditions[idx] >= 'a' && conditions[idx] <= 'z' {
+			idx++
+		}
+
+		selected := conditions[start:idx]
+		if selected != "" {
+			letters = true
+		} else if negate {
+			return nil, table, false, fmt.Errorf("missing letters after <%d-> in game rule <%s>", count, rule)
+		}
+
+		// first select all configurations with count life neighbors
+		for mask := 0; mask < 256; mask++ {
+			if bits.OnesCount8(uint8(mask)) == count {
+				table[mask] = selected == "" || negate
+			}
+		}
+
+		for _, letter := range []byte(selected) {
+			masks, ok := HenselMasks(count, letter)
+			if !ok {
+				return nil, table, false,
+					fmt.Errorf("invalid letter <%c> for count %d in game rule <%s>", letter, count, rule)
+			}
+
+			for _, mask := range masks {
+				table[mask] = !negate
+			}
+		}
+	}
+
+	return counts, table, letters, nil
+}
+
+// the conditions of a table in canonical form: counts in ascending
+// order, each one followed by the selected letters or by a minus and
+// the letters left out, whichever is shorter
+func HenselConditions(table *[256]bool) string {
+	var conditions strings.Builder
+
+	for count := 0; count <= 8; count++ {
+		selected, excluded := "", ""
+		letters := HENSEL_LETTERS[:len(HENSEL[min(count, 8-count)])]
+
+		for _, letter := range []byte(letters) {
+			masks, _ := HenselMasks(count, letter)
+
+			if table[masks[0]] {
+				selected += string(letter)
+			} else {
+				excluded += string(letter)
+			}
+		}
+
+		switch {
+		case count == 0 || count == 8:
+			// only one configuration, no letters
+			if table[uint8(0xff*count/8)] {
+				conditions.WriteByte('0' + byte(count))
+			}
+		case selected == "":
+		case excluded == "":
+			conditions.WriteByte('0' + byte(count))
+		case len(excluded) < len(selected):
+			conditions.WriteString(fmt.Sprintf("%d-%s", count, excluded))
+		default:
+			conditions.WriteString(fmt.Sprintf("%d%s", count, selected))
+		}
+	}
+
+	return conditions.String()
+}
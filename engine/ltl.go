@@ -0,0 +1,257 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Larger than Life rules, see https://conwaylife.com/wiki/Larger_than_Life
+//
+// The rule R5,C0,M1,S34..58,B34..45,NM reads: range 5, 2 states (C0 and
+// C2 are the same, more states work like Generations rules), the middle
+// cell  is counted  as well,  life cells  survive with  34 to  58 life
+// cells in their neighborhood, dead ones are born with 34 to 45. NM is
+// the Moore neighborhood (a square), NN the von Neumann one (a diamond).
+//
+// Neighborhoods get large, so cells are not counted one by one. Instead
+// we build a  summed-area table of the whole grid once  per generation,
+// which gives the sum of any rectangle using 4 lookups. A square is one
+// rectangle, a diamond is summed up row by row.
+
+const (
+	LTL_MAX_RANGE = 500
+
+	MOORE       = 'M'
+	VON_NEUMANN = 'N'
+)
+
+// true if the rule string uses the Larger than Life syntax
+func IsLargerThanLife(rule string) bool {
+	return strings.HasPrefix(strings.ToUpper(rule), "R") && strings.Contains(rule, ",")
+}
+
+// parse a Larger than Life rule
+func ParseLargerThanLife(rule string) (*Rule, error) {
+	golrule := &Rule{
+		Definition:   rule,
+		States:       2,
+		Neighborhood: MOORE,
+	}
+
+	// the parts given, range, survival and birth are required
+	seen := map[byte]bool{}
+
+	for _, part := range strings.Split(strings.ToUpper(rule), ",") {
+		if len(part) < 2 {
+			return nil, fmt.Errorf("invalid game rule part <%s> in <%s>", part, rule)
+		}
+
+		seen[part[0]] = true
+
+		var (
+			value  = part[1:]
+			number int
+			err    error
+		)
+
+		switch part[0] {
+		case 'R':
+			golrule.Range, err = ParseLtLNumber(rule, value, 1, LTL_MAX_RANGE)
+		case 'C':
+			// C0 means 2 states as well
+			number, err = ParseLtLNumber(rule, value, 0, 256)
+			golrule.States = max(2, number)
+		case 'M':
+			number, err = ParseLtLNumber(rule, value, 0, 1)
+			golrule.Middle = number == 1
+		case 'S':
+			golrule.SurviveMin, golrule.SurviveMax, err = ParseLtLRange(rule, value)
+		case 'B':
+			golrule.BirthMin, golrule.BirthMax, err = ParseLtLRange(rule, value)
+		case 'N':
+			if value != string(MOORE) && value != string(VON_NEUMANN) {
+				err = fmt.Errorf("invalid neighborhood <%s> in game rule <%s>, expecting NM or NN", value, rule)
+			}
+
+			golrule.Neighborhood = value[0]
+		default:
+			err = fmt.Errorf("invalid game rule part <%s> in <%s>", part, rule)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case !seen['R']:
+		return nil, fmt.Errorf("missing range in game rule <%s>", rule)
+	case !seen['S']:
+		return nil, fmt.Errorf("missing survival range in game rule <%s>", rule)
+	case !seen['B']:
+		return nil, fmt.Errorf("missing birth range in game rule <%s>", rule)
+	}
+
+	return golrule, nil
+}
+
+func ParseLtLNumber(rule, value string, lower, upper int) (int, error) {
+	number, err := strconv.Atoi(value)
+	if err != nil || number < lower || number > upper {
+		return 0, fmt.Errorf("invalid number <%s> in game rule <%s>, expecting %d..%d",
+			value, rule, lower, upper)
+	}
+
+	return number, nil
+}
+
+// parse a range like 34..58
+func ParseLtLRange(rule, value string) (int, int, error) {
+	from, to, found := strings.Cut(value, "..")
+	if !found {
+		to = from
+	}
+
+	limit := (2*LTL_MAX_RANGE + 1) * (2*LTL_MAX_RANGE + 1)
+
+	lower, err := ParseLtLNumber(rule, from, 0, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	upper, err := ParseLtLNumber(rule, to, lower, limit)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return lower, upper, nil
+}
+
+// the rule in canonical form like R5,C0,M1,S34..58,B34..45,NM
+func (rule *Rule) CanonicalLargerThanLife() string {
+	states := rule.States
+	if states == 2 {
+		states = 0
+	}
+
+	return fmt.Sprintf("R%d,C%d,M%d,S%d..%d,B%d..%d,N%c",
+		rule.Range, states, bool2int(rule.Middle),
+		rule.SurviveMin, rule.SurviveMax, rule.BirthMin, rule.BirthMax, rule.Neighborhood)
+}
+
+// true if the rule is a Larger than Life rule
+func (rule *Rule) IsLargerThanLife() bool {
+	return rule.Range > 0
+}
+
+// compute the next state of a cell using the number of life cells in
+// its neighborhood, which includes the cell itself if Middle is set
+func (rule *Rule) CheckLargerThanLife(state uint8, count int) uint8 {
+	switch {
+	case state == Dead:
+		if count >= rule.BirthMin && count <= rule.BirthMax {
+			return Alive
+		}
+
+		return Dead
+	case state == Alive && count >= rule.SurviveMin && count <= rule.SurviveMax:
+		return Alive
+	case int(state)+1 >= rule.States:
+		return Dead
+	}
+
+	// start or continue dying
+	return state + 1
+}
+
+// build the summed-area table of the life cells. The table covers the
+// grid plus  a border  of Range cells,  which either  contains the cells
+// from the other side(s) of the grid in wrap mode or dead cells.
+func (grid *Grid) SummedAreaTable(data []uint8, radius int) []int32 {
+	width := grid.Width + 2*radius + 1
+	height := grid.Height + 2*radius + 1
+
+	if len(grid.sat) != width*height {
+		grid.sat = make([]int32, width*height)
+	}
+
+	sat := grid.sat
+
+	for row := 1; row < height; row++ {
+		var rowsum int32
+
+		for col := 1; col < width; col++ {
+			x, y, ok := grid.Neighbor(col-1-radius, row-1-radius)
+
+			if ok && data[y*grid.Width+x] == Alive {
+				rowsum++
+			}
+
+			sat[row*width+col] = sat[(row-1)*width+col] + rowsum
+		}
+	}
+
+	return sat
+}
+
+// compute the next generation of the whole grid, one goroutine per row
+func (grid *Grid) StepLargerThanLife(next int) {
+	rule := grid.ltl
+	radius := rule.Range
+	current := grid.Data[grid.Index]
+	nextdata := grid.Data[next]
+
+	sat := grid.SummedAreaTable(current, radius)
+	width := grid.Width + 2*radius + 1
+
+	// sum of the rectangle between the cells x1,y1 and x2,y2 inclusive,
+	// using table coordinates
+	sum := func(x1, y1, x2, y2 int) int {
+		return int(sat[(y2+1)*width+x2+1] - sat[y1*width+x2+1] -
+			sat[(y2+1)*width+x1] + sat[y1*width+x1])
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(grid.Height)
+
+	for y := 0; y < grid.Height; y++ {
+		go func() {
+			defer wg.Done()
+
+			for x := 0; x < grid.Width; x++ {
+				idx := y*grid.Width + x
+
+				// the cell is at x+radius,y+radius in the table
+				var count int
+
+				if rule.Neighborhood == VON_NEUMANN {
+					for dy := -radius; dy <= radius; dy++ {
+						span := radius - max(dy, -dy)
+						count += sum(x+radius-span, y+radius+dy, x+radius+span, y+radius+dy)
+					}
+				} else {
+					count = sum(x, y, x+2*radius, y+2*radius)
+				}
+
+				state := current[idx]
+
+				if !rule.Middle && state == Alive {
+					count--
+				}
+
+				nextstate := rule.CheckLargerThanLife(state, count)
+				nextdata[idx] = nextstate
+
+				if state != nextstate {
+					grid.Ages[idx] = grid.generation + 1
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	grid.active = grid.Width * grid.Height
+}
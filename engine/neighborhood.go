@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"fmt"
+	"math/bits"
+	"slices"
+	"strings"
+)
+
+// Golly style neighborhood suffixes, see
+// https://golly.sourceforge.io/Help/Algorithms/QuickLife.html
+//
+// B2/S34H uses the hexagonal neighborhood, B2/S013V the von Neumann
+// neighborhood. Both are subsets of the  8 Moore neighbors: the von
+// Neumann neighborhood consists of the orthogonal neighbors, a hex grid
+// is emulated by  skewing it, so the NE  and SW neighbors are left out.
+// Such rules are translated into neighborhood mask tables, just like the
+// Hensel rules, so every engine which knows these supports them as well.
+
+const HEXAGONAL = 'H'
+
+// the neighbors, which are part of a neighborhood
+var NEIGHBORS = map[byte]uint8{
+	MOORE:       N | NE | E | SE | S | SW | W | NW,
+	VON_NEUMANN: N | E | S | W,
+	HEXAGONAL:   N | E | SE | S | W | NW,
+}
+
+// remove the neighborhood suffix of a rule, returns the rule without it
+// and the neighborhood
+func CutNeighborhood(rule string) (string, byte) {
+	switch {
+	case strings.HasSuffix(strings.ToUpper(rule), "H"):
+		return rule[:len(rule)-1], HEXAGONAL
+	case strings.HasSuffix(strings.ToUpper(rule), "V"):
+		return rule[:len(rule)-1], VON_NEUMANN
+	}
+
+	return rule, MOORE
+}
+
+// the rule suffix of a neighborhood, the inverse of CutNeighborhood
+func NeighborhoodSuffix(neighborhood byte) string {
+	switch neighborhood {
+	case HEXAGONAL:
+		return "H"
+	case VON_NEUMANN:
+		return "V"
+	}
+
+	return ""
+}
+
+// the neighbors taken into account by the rule, all 8 by default
+func (rule *Rule) NeighborMask() uint8 {
+	if mask, ok := NEIGHBORS[rule.Neighborhood]; ok {
+		return mask
+	}
+
+	return NEIGHBORS[MOORE]
+}
+
+// true if the rule doesn't use the default Moore neighborhood, Larger
+// than Life rules have their own neighborhoods
+func (rule *Rule) HasReducedNeighborhood() bool {
+	return !rule.IsLargerThanLife() && rule.NeighborMask() != NEIGHBORS[MOORE]
+}
+
+// translate the birth and survive  counts into neighborhood mask tables,
+// which only count the neighbors being part of the neighborhood
+func (rule *Rule) SetupNeighborhood() error {
+	if rule.NonTotalistic {
+		return fmt.Errorf("Hensel notation can not be used with the neighborhood of game rule <%s>",
+			rule.Definition)
+	}
+
+	neighbors := rule.NeighborMask()
+	count := uint8(bits.OnesCount8(neighbors))
+
+	for _, list := range [][]uint8{rule.Birth, rule.Death} {
+		for _, number := range list {
+			if number > count {
+				return fmt.Errorf("invalid neighbor count %d in game rule <%s>, expecting 0..%d",
+					number, rule.Definition, count)
+			}
+		}
+	}
+
+	for mask := 0; mask < 256; mask++ {
+		count := uint8(bits.OnesCount8(uint8(mask) & neighbors))
+
+		rule.BirthTable[mask] = slices.Contains(rule.Birth, count)
+		rule.SurviveTable[mask] = slices.Contains(rule.Death, count)
+	}
+
+	rule.NonTotalistic = true
+
+	return nil
+}
@@ -0,0 +1,282 @@
+package engine
+
+import (
+	"image"
+	"sync"
+)
+
+// The Plane is an  unbounded universe. Cells are stored  in tiles of
+// TILE_SIZE x TILE_SIZE cells, which  are kept in a map indexed by the
+// tile position. Tiles are created when a pattern grows into them and
+// dropped again as soon as they are empty, so only the active regions
+// of the universe occupy memory.
+//
+// Coordinates are signed, tile positions  are computed using shifts,
+// which round towards negative infinity, so -1 is in tile -1, not 0.
+
+const (
+	TILE_SHIFT = 5
+	TILE_SIZE  = 1 << TILE_SHIFT
+	TILE_MASK  = TILE_SIZE - 1
+)
+
+type Tile struct {
+	Cells      [TILE_SIZE * TILE_SIZE]uint8
+	Population int // number of non-dead cells
+}
+
+type Plane struct {
+	Tiles         map[image.Point]*Tile
+	RuleCheckFunc func(uint8, uint8) uint8
+	NonTotalistic bool // pass the neighborhood mask instead of the count
+
+	strobe     Strobe // phase of B0 rules, see strobe.go
+	generation int64
+}
+
+func NewPlane(options Options) *Plane {
+	plane := &Plane{
+		Tiles: make(map[image.Point]*Tile),
+	}
+
+	plane.SetRule(options.Rule)
+
+	return plane
+}
+
+func (plane *Plane) SetRule(rule *Rule) {
+	plane.strobe.SetRule(rule)
+	plane.RuleCheckFunc = rule.CheckFunc()
+	plane.NonTotalistic = rule.NonTotalistic
+}
+
+func (plane *Plane) Generation() int64 {
+	return plane.generation
+}
+
+func (plane *Plane) Inverted() bool {
+	return plane.strobe.Inverted
+}
+
+func (plane *Plane) SetInverted(inverted bool) {
+	plane.strobe.Inverted = inverted
+}
+
+func (plane *Plane) Population() int64 {
+	var population int64
+
+	for _, tile := range plane.Tiles {
+		population += int64(tile.Population)
+	}
+
+	return population
+}
+
+// return the position of the tile containing the given cell
+func TilePos(x, y int) image.Point {
+	return image.Point{X: x >> TILE_SHIFT, Y: y >> TILE_SHIFT}
+}
+
+func (plane *Plane) Get(x, y int) uint8 {
+	tile, ok := plane.Tiles[TilePos(x, y)]
+	if !ok {
+		return Dead
+	}
+
+	return tile.Cells[(y&TILE_MASK)*TILE_SIZE+(x&TILE_MASK)]
+}
+
+func (plane *Plane) Set(x, y int, state uint8) {
+	pos := TilePos(x, y)
+
+	tile, ok := plane.Tiles[pos]
+	if !ok {
+		if state == Dead {
+			return
+		}
+
+		tile = &Tile{}
+		plane.Tiles[pos] = tile
+	}
+
+	idx := (y&TILE_MASK)*TILE_SIZE + (x & TILE_MASK)
+	tile.Population += bool2int(state != Dead) - bool2int(tile.Cells[idx] != Dead)
+	tile.Cells[idx] = state
+
+	if tile.Population == 0 {
+		delete(plane.Tiles, pos)
+	}
+}
+
+// call action for every non-dead cell inside rect
+func (plane *Plane) Each(rect image.Rectangle, action func(x, y int)) {
+	for pos, tile := range plane.Tiles {
+		area := image.Rect(0, 0, TILE_SIZE, TILE_SIZE).Add(pos.Mul(TILE_SIZE)).Intersect(rect)
+
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if tile.Cells[(y&TILE_MASK)*TILE_SIZE+(x&TILE_MASK)] != Dead {
+					action(x, y)
+				}
+			}
+		}
+	}
+}
+
+// return the bounding box of all non-dead cells
+func (plane *Plane) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	for pos, tile := range plane.Tiles {
+		for idx, cell := range tile.Cells {
+			if cell != Dead {
+				x := pos.X*TILE_SIZE + idx%TILE_SIZE
+				y := pos.Y*TILE_SIZE + idx/TILE_SIZE
+
+				bounds = bounds.Union(image.Rect(x, y, x+1, y+1))
+			}
+		}
+	}
+
+	return bounds
+}
+
+func (plane *Plane) Step(generations int64) {
+	for ; generations > 0; generations-- {
+		plane.StepOnce()
+	}
+}
+
+// compute the next generation. Every  non-empty tile and its neighbors
+// are candidates for the next generation, each one is computed in its
+// own goroutine, empty results are dropped.
+func (plane *Plane) StepOnce() {
+	if plane.strobe.Active() {
+		plane.RuleCheckFunc = plane.strobe.Next().CheckFunc()
+	}
+
+	candidates := make(map[image.Point]bool, len(plane.Tiles)*2)
+
+	for pos := range plane.Tiles {
+		for nbgY := -1; nbgY < 2; nbgY++ {
+			for nbgX := -1; nbgX < 2; nbgX++ {
+				candidates[pos.Add(image.Point{X: nbgX, Y: nbgY})] = true
+			}
+		}
+	}
+
+	positions := make([]image.Point, 0, len(candidates))
+	for pos := range candidates {
+		positions = append(positions, pos)
+	}
+
+	results := make([]*Tile, len(positions))
+
+	var wg sync.WaitGroup
+	wg.Add(len(positions))
+
+	for idx, pos := range positions {
+		go func() {
+			defer wg.Done()
+			results[idx] = plane.StepTile(pos)
+		}()
+	}
+
+	wg.Wait()
+
+	plane.Tiles = make(map[image.Point]*Tile, len(positions))
+
+	for idx, tile := range results {
+		if tile != nil {
+			plane.Tiles[positions[idx]] = tile
+		}
+	}
+
+	plane.generation++
+}
+
+// compute the next generation of one tile, returns nil if it is empty
+func (plane *Plane) StepTile(pos image.Point) *Tile {
+	// copy the tile including a one cell  wide border taken from the
+	// neighbor tiles, so that we don't need any map lookups per cell
+	const size = TILE_SIZE + 2
+
+	// states of the area and the life cells only, which are counted
+	var area, life [size * size]uint8
+
+	empty := true
+
+	for nbgY := -1; nbgY < 2; nbgY++ {
+		for nbgX := -1; nbgX < 2; nbgX++ {
+			tile, ok := plane.Tiles[pos.Add(image.Point{X: nbgX, Y: nbgY})]
+			if !ok {
+				continue
+			}
+
+			empty = false
+
+			for y := 0; y < size; y++ {
+				tileY := y - 1 - nbgY*TILE_SIZE
+				if tileY < 0 || tileY >= TILE_SIZE {
+					continue
+				}
+
+				for x := 0; x < size; x++ {
+					tileX := x - 1 - nbgX*TILE_SIZE
+					if tileX < 0 || tileX >= TILE_SIZE {
+						continue
+					}
+
+					area[y*size+x] = tile.Cells[tileY*TILE_SIZE+tileX]
+
+					if area[y*size+x] == Alive {
+						life[y*size+x] = 1
+					}
+				}
+			}
+		}
+	}
+
+	if empty {
+		return nil
+	}
+
+	next := &Tile{}
+
+	for y := 1; y <= TILE_SIZE; y++ {
+		for x := 1; x <= TILE_SIZE; x++ {
+			center := y*size + x
+
+			var neighbors uint8
+
+			if plane.NonTotalistic {
+				for bit, offset := range NEIGHBORHOOD {
+					neighbors |= life[center+offset.Y*size+offset.X] << bit
+				}
+			} else {
+				neighbors = life[center-size-1] + life[center-size] + life[center-size+1] +
+					life[center-1] + life[center+1] +
+					life[center+size-1] + life[center+size] + life[center+size+1]
+			}
+
+			state := plane.RuleCheckFunc(area[center], neighbors)
+
+			next.Cells[(y-1)*TILE_SIZE+x-1] = state
+			next.Population += bool2int(state != Dead)
+		}
+	}
+
+	if next.Population == 0 {
+		return nil
+	}
+
+	return next
+}
+
+func bool2int(b bool) int {
+	if b {
+		return 1
+	}
+
+	return 0
+}
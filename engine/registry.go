@@ -0,0 +1,86 @@
+package engine
+
+import (
+	"strings"
+)
+
+// Well known rules, which can be used by name, like -r HighLife. Names
+// are compared ignoring case, blanks and punctuation, so DayAndNight,
+// "Day & Night" and day-and-night are the same. See
+// https://conwaylife.com/wiki/List_of_Life-like_rules
+
+type NamedRule struct {
+	Name        string
+	Definition  string
+	Description string
+	Aliases     []string
+}
+
+var RULES = []NamedRule{
+	{"Life", "B3/S23", "Conway's Game of Life", []string{"GameOfLife", "Conway"}},
+	{"HighLife", "B36/S23", "like Life, but with a small replicator", nil},
+	{"DayAndNight", "B3678/S34678", "dead and life cells behave the same", []string{"Day & Night"}},
+	{"Seeds", "B2/S", "every life cell dies, explosive growth", nil},
+	{"LifeWithoutDeath", "B3/S012345678", "life cells never die, ladders grow", []string{"Inkspot", "Flakes"}},
+	{"Replicator", "B1357/S1357", "every pattern is replicated", nil},
+	{"Diamoeba", "B35678/S5678", "large diamond shaped blobs", nil},
+	{"2x2", "B36/S125", "patterns made of 2x2 blocks", nil},
+	{"Morley", "B368/S245", "lots of spaceships", []string{"Move"}},
+	{"Anneal", "B4678/S35678", "majority vote, blobs smooth out", []string{"TwistedMajority"}},
+	{"Maze", "B3/S12345", "grows maze like structures", nil},
+	{"Mazectric", "B3/S1234", "grows mazes with long corridors", nil},
+	{"Coral", "B3/S45678", "slowly growing coral like structures", nil},
+	{"LongLife", "B345/S5", "long lived oscillators", nil},
+	{"DryLife", "B37/S23", "like Life, with a few more oscillators", nil},
+	{"PedestrianLife", "B38/S23", "like Life, with a different replicator", nil},
+	{"Amoeba", "B357/S1358", "chaotic blobs with a fuzzy border", nil},
+	{"Gnarl", "B1/S1", "explodes into gnarly structures", nil},
+	{"BriansBrain", "B2/S/C3", "Generations rule with three states, lots of spaceships", []string{"Brian's Brain"}},
+	{"StarWars", "B2/S345/C4", "Generations rule with four states", []string{"Star Wars"}},
+	{"Rule30", "W30", "one-dimensional, chaotic", nil},
+	{"Rule110", "W110", "one-dimensional, Turing complete", nil},
+}
+
+// find a rule by its name or one of its aliases
+func LookupRule(name string) (NamedRule, bool) {
+	key := NormalizeRuleName(name)
+
+	for _, named := range RULES {
+		if NormalizeRuleName(named.Name) == key {
+			return named, true
+		}
+
+		for _, alias := range named.Aliases {
+			if NormalizeRuleName(alias) == key {
+				return named, true
+			}
+		}
+	}
+
+	return NamedRule{}, false
+}
+
+// lowercase name without blanks and punctuation
+func NormalizeRuleName(name string) string {
+	return strings.Map(func(char rune) rune {
+		switch {
+		case char >= 'a' && char <= 'z', char >= '0' && char <= '9':
+			return char
+		case char >= 'A' && char <= 'Z':
+			return char - 'A' + 'a'
+		}
+
+		return -1
+	}, name)
+}
+
+// names of all registered rules
+func RuleNames() []string {
+	names := make([]string, len(RULES))
+
+	for idx, named := range RULES {
+		names[idx] = named.Name
+	}
+
+	return names
+}
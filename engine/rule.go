@@ -0,0 +1,349 @@
+package engine
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// a GOL rule
+type Rule struct {
+	Definition string
+	Name       string // name of a registered rule like HighLife, see registry.go
+	Birth      []uint8
+	Death      []uint8 // neighbor counts a life cell survives with
+	States     int     // number of cell states, 2 for life, more for Generations rules
+
+	// Hensel  notation: the neighbors  are passed as mask  instead of
+	// count, the tables say which configurations lead to a life cell
+	NonTotalistic            bool
+	BirthTable, SurviveTable [256]bool
+
+	// Larger than Life, see ltl.go
+	Range                  int  // radius of the neighborhood, 0 if not LtL
+	Middle                 bool // count the cell itself
+	SurviveMin, SurviveMax int
+	BirthMin, BirthMax     int
+	Neighborhood           byte // MOORE, VON_NEUMANN or HEXAGONAL, see neighborhood.go
+
+	Topology Topology // bounded grid suffix like :T100,80, see topology.go
+
+	Table *RuleTable // rule loaded from a Golly rule file, see ruletable.go
+
+	// one-dimensional rules like W110, see elementary.go
+	Elementary bool
+	Wolfram    uint8 // the rule number
+}
+
+// parse GOL rule, used in CheckRule(). Every rule may end with a
+// topology suffix like B3/S23:T100,80. Registered rules can be given by
+// name like HighLife. The definition of the parsed rule is always in
+// canonical form, so 23/3, b3/s23 and Life all become B3/S23.
+func ParseGameRule(rule string) (*Rule, error) {
+	definition, suffix, found := strings.Cut(strings.TrimSpace(rule), ":")
+
+	named, registered := LookupRule(definition)
+	if registered {
+		definition = named.Definition
+	}
+
+	golrule, err := ParseLifeRule(definition)
+	if err != nil {
+		return nil, err
+	}
+
+	golrule.Name = named.Name
+	golrule.Definition = golrule.Canonical()
+
+	if found {
+		golrule.Topology, err = ParseTopology(rule, suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		golrule.Definition += ":" + golrule.Topology.String()
+	}
+
+	return golrule, nil
+}
+
+// parse a rule without topology. Supported are B3/S23, S23/B3, b3/s23
+// and the MCell notation  23/3 (survive/birth). Generations rules like
+// B2/S/C3 or 345/2/4 (survive/birth/states) have dying cells passing
+// through a number of refractory states. All of them may end with a
+// neighborhood suffix like B2/S34H.
+func ParseLifeRule(rule string) (*Rule, error) {
+	if IsLargerThanLife(rule) {
+		return ParseLargerThanLife(rule)
+	}
+
+	if IsElementary(rule) {
+		return ParseElementary(rule)
+	}
+
+	definition, neighborhood := CutNeighborhood(rule)
+
+	parts := strings.Split(definition, "/")
+
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid game rule <%s>", rule)
+	}
+
+	golrule := &Rule{Definition: rule, States: 2, Neighborhood: neighborhood}
+
+	var err error
+
+	if IsNumericRule(parts) {
+		// MCell notation: survive/birth or survive/birth/states
+		golrule.Death, golrule.SurviveTable, _, err = ParseConditions(rule, parts[0])
+		if err != nil {
+			return nil, err
+		}
+
+		golrule.Birth, golrule.BirthTable, _, err = ParseConditions(rule, parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		if len(parts) == 3 {
+			if golrule.States, err = ParseStates(rule, parts[2]); err != nil {
+				return nil, err
+			}
+		}
+
+		return golrule, golrule.Setup()
+	}
+
+	seen := map[byte]bool{}
+
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("invalid game rule <%s>", rule)
+		}
+
+		kind := strings.ToUpper(part)[0]
+		if seen[kind] {
+			return nil, fmt.Errorf("duplicate game rule part <%s> in <%s>", part, rule)
+		}
+
+		seen[kind] = true
+
+		var letters bool
+
+		switch kind {
+		case 'B':
+			golrule.Birth, golrule.BirthTable, letters, err = ParseConditions(rule, part[1:])
+		case 'S':
+			golrule.Death, golrule.SurviveTable, letters, err = ParseConditions(rule, part[1:])
+		case 'C':
+			golrule.States, err = ParseStates(rule, part[1:])
+		default:
+			err = fmt.Errorf("invalid game rule part <%s> in <%s>", part, rule)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		golrule.NonTotalistic = golrule.NonTotalistic || letters
+	}
+
+	if !seen['B'] || !seen['S'] {
+		return nil, fmt.Errorf("game rule <%s> needs a B and an S part", rule)
+	}
+
+	return golrule, golrule.Setup()
+}
+
+// true if the parts of a rule contain only digits,  the last part may be
+// the number of states of a Generations rule
+func IsNumericRule(parts []string) bool {
+	for _, part := range parts {
+		if strings.TrimLeft(part, "0123456789") != "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// sort the neighbor counts and setup the neighborhood tables if needed
+func (rule *Rule) Setup() error {
+	for _, list := range []*[]uint8{&rule.Birth, &rule.Death} {
+		slices.Sort(*list)
+		*list = slices.Compact(*list)
+	}
+
+	if rule.HasReducedNeighborhood() {
+		return rule.SetupNeighborhood()
+	}
+
+	return nil
+}
+
+// parse the number of states of a Generations rule
+func ParseStates(rule, states string) (int, error) {
+	count, err := strconv.Atoi(states)
+	if err != nil || count < 2 || count > 256 {
+		return 0, fmt.Errorf("invalid number of states <%s> in game rule <%s>", states, rule)
+	}
+
+	return count, nil
+}
+
+// the rule  in its canonical form: B3/S23, Generations  rules end with
+// the number of states like B2/S/C3, reduced neighborhoods with H or V.
+// The topology is not part of it.
+func (rule *Rule) Canonical() string {
+	switch {
+	case rule.Table != nil:
+		return rule.Table.Name
+	case rule.IsLargerThanLife():
+		return rule.CanonicalLargerThanLife()
+	case rule.Elementary:
+		return fmt.Sprintf("W%d", rule.Wolfram)
+	}
+
+	var birth, survive string
+
+	if rule.NonTotalistic && !rule.HasReducedNeighborhood() {
+		birth = HenselConditions(&rule.BirthTable)
+		survive = HenselConditions(&rule.SurviveTable)
+	} else {
+		birth = ListToNumbers(rule.Birth)
+		survive = ListToNumbers(rule.Death)
+	}
+
+	canonical := "B" + birth + "/S" + survive
+
+	if rule.IsGenerations() {
+		canonical += fmt.Sprintf("/C%d", rule.States)
+	}
+
+	if rule.HasReducedNeighborhood() {
+		canonical += NeighborhoodSuffix(rule.Neighborhood)
+	}
+
+	return canonical
+}
+
+// the digits of a list of neighbor counts
+func ListToNumbers(list []uint8) string {
+	var numbers strings.Builder
+
+	for _, count := range list {
+		numbers.WriteByte('0' + count)
+	}
+
+	return numbers.String()
+}
+
+// true if dead cells without any life neighbor are being born
+func (rule *Rule) HasB0() bool {
+	if rule.IsLargerThanLife() {
+		return rule.BirthMin == 0
+	}
+
+	return slices.Contains(rule.Birth, 0)
+}
+
+// true if the rule has refractory states besides dead and alive
+func (rule *Rule) IsGenerations() bool {
+	return rule.States > 2
+}
+
+// return the function used to compute the next state of a cell
+func (rule *Rule) CheckFunc() func(uint8, uint8) uint8 {
+	if rule.IsGenerations() {
+		return rule.CheckRuleGenerations
+	}
+
+	// Hensel rules listing all letters look like B3/S23 as well
+	if definition, _, _ := strings.Cut(rule.Definition, ":"); definition == "B3/S23" && !rule.NonTotalistic {
+		return CheckRuleB3S23
+	}
+
+	return rule.CheckRuleGeneric
+}
+
+/* The standard Scene of Life is symbolized in rule-string notation
+ * as B3/S23 (23/3 here).  A cell  is born if it has exactly three
+ * neighbors,  survives if it  has two or three  living neighbors,
+ * and  dies otherwise.
+ * we  abbreviate the calculation: if  state is 0 and  3 neighbors
+ * are a life, check will be just  3. If the cell is alive, 9 will
+ * be added  to the life neighbors (to avoid  a collision with the
+ * result 3), which will be 11|12 in case of 2|3 life neighbors.
+ */
+func CheckRuleB3S23(state uint8, neighbors uint8) uint8 {
+	switch (9 * state) + neighbors {
+	case 11:
+		fallthrough
+	case 12:
+		fallthrough
+	case 3:
+		return Alive
+	}
+
+	return Dead
+}
+
+// true if a dead cell with the given neighbors is born. Neighbors is
+// the neighborhood mask for non-totalistic rules, the count otherwise.
+func (rule *Rule) Born(neighbors uint8) bool {
+	if rule.NonTotalistic {
+		return rule.BirthTable[neighbors]
+	}
+
+	return slices.Contains(rule.Birth, neighbors)
+}
+
+// true if a life cell with the given neighbors survives
+func (rule *Rule) Survives(neighbors uint8) bool {
+	if rule.NonTotalistic {
+		return rule.SurviveTable[neighbors]
+	}
+
+	return slices.Contains(rule.Death, neighbors)
+}
+
+/*
+ * The generic  rule checker is able  to calculate cell state  for any
+ * GOL rul, including B3/S23.
+ */
+func (rule *Rule) CheckRuleGeneric(state uint8, neighbors uint8) uint8 {
+	var nextstate uint8
+
+	if state != 1 && rule.Born(neighbors) {
+		nextstate = Alive
+	} else if state == 1 && rule.Survives(neighbors) {
+		nextstate = Alive
+	} else {
+		nextstate = Dead
+	}
+
+	return nextstate
+}
+
+/*
+ * Generations rules: a life cell which doesn't survive starts to die,
+ * it then passes  through all the refractory states until  it is dead.
+ * Dying cells don't count as neighbors and can't be born again.
+ */
+func (rule *Rule) CheckRuleGenerations(state uint8, neighbors uint8) uint8 {
+	switch {
+	case state == Dead:
+		if rule.Born(neighbors) {
+			return Alive
+		}
+
+		return Dead
+	case state == Alive && rule.Survives(neighbors):
+		return Alive
+	case int(state)+1 >= rule.States:
+		return Dead
+	}
+
+	return state + 1
+}
@@ -0,0 +1,639 @@
+package engine
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Golly rule files, see https://golly.sourceforge.io/Help/formats.html#rule
+//
+// A .rule file  defines an arbitrary automaton  with up to 256 states,
+// like Wireworld. The  next state of a  cell is looked up  in a rule
+// table or a rule tree, both  are supported for the Moore and the von
+// Neumann neighborhood:
+//
+//	@RULE WireWorld
+//	@TABLE
+//	n_states:4
+//	neighborhood:Moore
+//	symmetries:rotate8
+//	var a={0,1,2,3}
+//	...
+//	1,a,b,c,d,e,f,g,h,2
+//	@COLORS
+//	1 0 128 255
+//
+// The transitions of  a table are matched like Golly  does it: for each
+// position  and state  we keep  a bitset  of the  transitions matching
+// that state at that  position. ANDing the bitsets of a cell gives all
+// matching  transitions, the  first one  wins. Cells  without matching
+// transition keep their state.
+//
+// A tree is a decision tree: starting at the root, every neighbor state
+// selects the next node, the state of the cell itself the result.
+
+const RULE_SUFFIX = ".rule"
+
+// neighbor positions of tables as indices into NEIGHBORHOOD
+var TABLE_NEIGHBORS = map[string][]int{
+	"moore":      {0, 1, 2, 3, 4, 5, 6, 7}, // N, NE, E, SE, S, SW, W, NW
+	"vonneumann": {0, 2, 4, 6},             // N, E, S, W
+}
+
+// neighbor positions of trees, the order in which they are evaluated,
+// the cell itself comes last
+var TREE_NEIGHBORS = map[int][]int{
+	8: {7, 1, 5, 3, 0, 6, 2, 4}, // NW, NE, SW, SE, N, W, E, S
+	4: {0, 6, 2, 4},             // N, W, E, S
+}
+
+type RuleTable struct {
+	Name      string
+	States    int
+	Neighbors []int                // positions used by the rule, indices into NEIGHBORHOOD
+	Colors    map[uint8]color.RGBA // from @COLORS, may be empty
+
+	// @TABLE: per position  (the cell itself first) and state  a bitset
+	// of the matching transitions, and the output of every transition
+	match   [][][]uint64
+	outputs []uint8
+
+	// @TREE: nodes  with the next node per state,  or the result at the
+	// lowest level, the root is the last node
+	tree [][]int
+}
+
+// true if the rule is the name of a rule file
+func IsRuleFile(rule string) bool {
+	return strings.HasSuffix(rule, RULE_SUFFIX)
+}
+
+// load a rule file, the rule uses its @RULE name as definition
+func LoadRuleFile(filename string) (*Rule, error) {
+	fd, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	table, err := ParseRuleTable(fd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rule file %s: %w", filename, err)
+	}
+
+	return &Rule{
+		Definition: table.Name,
+		States:     table.States,
+		Table:      table,
+	}, nil
+}
+
+// parse the contents of a rule file
+func ParseRuleTable(input io.Reader) (*RuleTable, error) {
+	table := &RuleTable{Colors: map[uint8]color.RGBA{}}
+	sections := map[string][]string{}
+	section := ""
+
+	scanner := bufio.NewScanner(input)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "@"):
+			name, value, _ := strings.Cut(line, " ")
+			section = strings.ToUpper(name)
+
+			if section == "@RULE" {
+				table.Name = strings.TrimSpace(value)
+			}
+		default:
+			sections[section] = append(sections[section], line)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if table.Name == "" {
+		return nil, errors.New("missing @RULE name")
+	}
+
+	var err error
+
+	switch {
+	case sections["@TABLE"] != nil:
+		err = table.ParseTable(sections["@TABLE"])
+	case sections["@TREE"] != nil:
+		err = table.ParseTree(sections["@TREE"])
+	default:
+		err = errors.New("neither @TABLE nor @TREE found")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return table, table.ParseColors(sections["@COLORS"])
+}
+
+// a transition  before matching  tables are  built: the allowed states
+// of the cell, of every neighbor and the resulting state
+type transition struct {
+	inputs [][]uint8
+	output uint8
+}
+
+func (table *RuleTable) ParseTable(lines []string) error {
+	variables := map[string][]uint8{}
+	symmetries := "none"
+	transitions := []transition{}
+
+	table.Neighbors = TABLE_NEIGHBORS["moore"]
+
+	for number, line := range lines {
+		key, value, found := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+
+		var err error
+
+		switch {
+		case found && key == "n_states":
+			table.States, err = strconv.Atoi(value)
+			if err != nil || table.States < 2 || table.States > 256 {
+				return fmt.Errorf("invalid number of states <%s>", value)
+			}
+		case found && key == "neighborhood":
+			neighbors, ok := TABLE_NEIGHBORS[strings.ToLower(value)]
+			if !ok {
+				return fmt.Errorf("unsupported neighborhood <%s>, expecting Moore or vonNeumann", value)
+			}
+
+			table.Neighbors = neighbors
+		case found && key == "symmetries":
+			symmetries = value
+		case strings.HasPrefix(line, "var "):
+			err = table.ParseVariable(line, variables)
+		default:
+			var expanded []transition
+
+			expanded, err = table.ParseTransition(line, variables, symmetries)
+			transitions = append(transitions, expanded...)
+		}
+
+		if err != nil {
+			return fmt.Errorf("@TABLE line %d: %w", number+1, err)
+		}
+	}
+
+	if table.States == 0 {
+		return errors.New("missing n_states")
+	}
+
+	table.Compile(transitions)
+
+	return nil
+}
+
+// parse a variable like var a={0,1,b}, which may contain other variables
+func (table *RuleTable) ParseVariable(line string, variables map[string][]uint8) error {
+	name, values, found := strings.Cut(strings.TrimPrefix(line, "var "), "=")
+	if !found {
+		return fmt.Errorf("invalid variable <%s>", line)
+	}
+
+	values = strings.TrimSpace(values)
+	if !strings.HasPrefix(values, "{") || !strings.HasSuffix(values, "}") {
+		return fmt.Errorf("invalid variable values <%s>", values)
+	}
+
+	states := []uint8{}
+
+	for _, value := range strings.Split(values[1:len(values)-1], ",") {
+		list, err := table.ParseStates(strings.TrimSpace(value), variables)
+		if err != nil {
+			return err
+		}
+
+		states = append(states, list...)
+	}
+
+	variables[strings.TrimSpace(name)] = states
+
+	return nil
+}
+
+// return the states of a state number or a variable
+func (table *RuleTable) ParseStates(token string, variables map[string][]uint8) ([]uint8, error) {
+	if states, ok := variables[token]; ok {
+		return states, nil
+	}
+
+	state, err := strconv.Atoi(token)
+	if err != nil || state < 0 || state >= table.States {
+		return nil, fmt.Errorf("invalid state or unknown variable <%s>", token)
+	}
+
+	return []uint8{uint8(state)}, nil
+}
+
+// parse  a transition  like 0,a,b,c,1 or  the compact  form 0abc1 and
+// expand it  into all the  transitions it  stands for. A  variable used
+// more than once  must have the same value everywhere,  so those are
+// replaced by each of their values.
+func (table *RuleTable) ParseTransition(line string, variables map[string][]uint8, symmetries string) ([]transition, error) {
+	var tokens []string
+
+	if strings.Contains(line, ",") {
+		for _, token := range strings.Split(line, ",") {
+			tokens = append(tokens, strings.TrimSpace(token))
+		}
+	} else {
+		tokens = strings.Split(line, "")
+	}
+
+	if len(tokens) != len(table.Neighbors)+2 {
+		return nil, fmt.Errorf("expected %d states in transition <%s>", len(table.Neighbors)+2, line)
+	}
+
+	// variables used more than once are bound
+	used := map[string]int{}
+	for _, token := range tokens {
+		if _, ok := variables[token]; ok {
+			used[token]++
+		}
+	}
+
+	bound := []string{}
+	for name, count := range used {
+		if count > 1 {
+			bound = append(bound, name)
+		}
+	}
+
+	slices.Sort(bound)
+
+	output := tokens[len(tokens)-1]
+	if _, ok := variables[output]; ok && !slices.Contains(bound, output) {
+		return nil, fmt.Errorf("the output variable <%s> must be used as input as well", output)
+	}
+
+	transitions := []transition{}
+
+	var expand func(values map[string]uint8, index int) error
+
+	expand = func(values map[string]uint8, index int) error {
+		if index < len(bound) {
+			for _, state := range variables[bound[index]] {
+				values[bound[index]] = state
+
+				if err := expand(values, index+1); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		}
+
+		var next transition
+
+		for idx, token := range tokens {
+			states, err := table.ParseStates(token, variables)
+			if err != nil {
+				return err
+			}
+
+			if value, ok := values[token]; ok {
+				states = []uint8{value}
+			}
+
+			if idx == len(tokens)-1 {
+				next.output = states[0]
+			} else {
+				next.inputs = append(next.inputs, states)
+			}
+		}
+
+		symmetric, err := table.Symmetric(next, symmetries)
+		transitions = append(transitions, symmetric...)
+
+		return err
+	}
+
+	return transitions, expand(map[string]uint8{}, 0)
+}
+
+// return all variants of a transition according to the symmetries
+func (table *RuleTable) Symmetric(original transition, symmetries string) ([]transition, error) {
+	count := len(table.Neighbors)
+
+	// rotation by one position is a quarter turn for 4 neighbors
+	quarter := count / 4
+
+	rotate := func(steps int) []int {
+		permutation := make([]int, count)
+		for idx := range permutation {
+			permutation[idx] = (idx + steps) % count
+		}
+
+		return permutation
+	}
+
+	mirror := func(permutation []int) []int {
+		mirrored := make([]int, count)
+		for idx := range mirrored {
+			mirrored[idx] = permutation[(count-idx)%count]
+		}
+
+		return mirrored
+	}
+
+	var permutations [][]int
+
+	switch symmetries {
+	case "none":
+		permutations = [][]int{rotate(0)}
+	case "rotate4", "rotate4reflect":
+		for steps := 0; steps < count; steps += quarter {
+			permutations = append(permutations, rotate(steps))
+		}
+	case "rotate8", "rotate8reflect":
+		if count != 8 {
+			return nil, fmt.Errorf("symmetries %s need the Moore neighborhood", symmetries)
+		}
+
+		for steps := 0; steps < count; steps++ {
+			permutations = append(permutations, rotate(steps))
+		}
+	case "reflect_horizontal":
+		permutations = [][]int{rotate(0)}
+	case "permute":
+		permutations = Permutations(count)
+	default:
+		return nil, fmt.Errorf("unsupported symmetries <%s>", symmetries)
+	}
+
+	if strings.HasSuffix(symmetries, "reflect") || symmetries == "reflect_horizontal" {
+		for _, permutation := range permutations {
+			permutations = append(permutations, mirror(permutation))
+		}
+	}
+
+	transitions := []transition{}
+	seen := map[string]bool{}
+
+	for _, permutation := range permutations {
+		variant := transition{
+			inputs: [][]uint8{original.inputs[0]},
+			output: original.output,
+		}
+
+		for _, position := range permutation {
+			variant.inputs = append(variant.inputs, original.inputs[position+1])
+		}
+
+		key := variant.Key()
+		if !seen[key] {
+			seen[key] = true
+			transitions = append(transitions, variant)
+		}
+	}
+
+	return transitions, nil
+}
+
+// return a string identifying the inputs of a transition
+func (transition transition) Key() string {
+	var key strings.Builder
+
+	for _, states := range transition.inputs {
+		key.Write(states)
+		key.WriteByte(',')
+	}
+
+	return key.String()
+}
+
+// return all permutations of 0..count-1
+func Permutations(count int) [][]int {
+	if count == 0 {
+		return [][]int{{}}
+	}
+
+	permutations := [][]int{}
+
+	for _, shorter := range Permutations(count - 1) {
+		for position := 0; position <= len(shorter); position++ {
+			permutation := slices.Insert(slices.Clone(shorter), position, count-1)
+			permutations = append(permutations, permutation)
+		}
+	}
+
+	return permutations
+}
+
+// build the matching bitsets
+func (table *RuleTable) Compile(transitions []transition) {
+	words := (len(transitions) + 63) / 64
+
+	table.match = make([][][]uint64, len(table.Neighbors)+1)
+	for position := range table.match {
+		table.match[position] = make([][]uint64, table.States)
+
+		for state := range table.match[position] {
+			table.match[position][state] = make([]uint64, words)
+		}
+	}
+
+	table.outputs = make([]uint8, len(transitions))
+
+	for idx, transition := range transitions {
+		for position, states := range transition.inputs {
+			for _, state := range states {
+				table.match[position][state][idx/64] |= 1 << (idx % 64)
+			}
+		}
+
+		table.outputs[idx] = transition.output
+	}
+}
+
+// parse a rule tree
+func (table *RuleTable) ParseTree(lines []string) error {
+	var neighbors, nodes int
+
+	for number, line := range lines {
+		key, value, found := strings.Cut(line, "=")
+		if found {
+			count, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				return fmt.Errorf("@TREE line %d: invalid number <%s>", number+1, value)
+			}
+
+			switch strings.TrimSpace(key) {
+			case "num_states":
+				table.States = count
+			case "num_neighbors":
+				neighbors = count
+			case "num_nodes":
+				nodes = count
+			}
+
+			continue
+		}
+
+		fields := strings.Fields(line)
+		node := make([]int, len(fields))
+
+		for idx, field := range fields {
+			value, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("@TREE line %d: invalid node <%s>", number+1, line)
+			}
+
+			node[idx] = value
+		}
+
+		if len(node) != table.States+1 {
+			return fmt.Errorf("@TREE line %d: expected %d values", number+1, table.States+1)
+		}
+
+		// references must point to existing nodes one level below,
+		// results must be states
+		for _, next := range node[1:] {
+			if next < 0 || (node[0] == 1 && next >= table.States) ||
+				(node[0] > 1 && (next >= len(table.tree) || table.tree[next][0] != node[0]-1)) {
+				return fmt.Errorf("@TREE line %d: invalid reference %d", number+1, next)
+			}
+		}
+
+		table.tree = append(table.tree, node)
+	}
+
+	var ok bool
+
+	table.Neighbors, ok = TREE_NEIGHBORS[neighbors]
+
+	switch {
+	case !ok:
+		return fmt.Errorf("unsupported number of neighbors %d, expecting 4 or 8", neighbors)
+	case table.States < 2 || table.States > 256:
+		return fmt.Errorf("invalid number of states %d", table.States)
+	case len(table.tree) == 0 || len(table.tree) != nodes:
+		return fmt.Errorf("expected %d nodes, got %d", nodes, len(table.tree))
+	case table.tree[len(table.tree)-1][0] != neighbors+1:
+		return errors.New("the root node has the wrong level")
+	}
+
+	return nil
+}
+
+// parse colors like "1 255 0 0" (state, red, green, blue)
+func (table *RuleTable) ParseColors(lines []string) error {
+	for _, line := range lines {
+		fields := strings.Fields(line)
+
+		// gradients are not supported
+		if len(fields) != 4 {
+			continue
+		}
+
+		values := make([]uint8, 4)
+
+		for idx, field := range fields {
+			value, err := strconv.Atoi(field)
+			if err != nil || value < 0 || value > 255 {
+				return fmt.Errorf("invalid color <%s>", line)
+			}
+
+			values[idx] = uint8(value)
+		}
+
+		table.Colors[values[0]] = color.RGBA{values[1], values[2], values[3], 255}
+	}
+
+	return nil
+}
+
+// compute the next state of a cell, neighbors are indexed like
+// NEIGHBORHOOD
+func (table *RuleTable) Next(state uint8, neighbors *[8]uint8) uint8 {
+	if int(state) >= table.States {
+		return state
+	}
+
+	for _, position := range table.Neighbors {
+		if int(neighbors[position]) >= table.States {
+			return state
+		}
+	}
+
+	if table.tree != nil {
+		node := len(table.tree) - 1
+
+		for _, position := range table.Neighbors {
+			node = table.tree[node][1+int(neighbors[position])]
+		}
+
+		return uint8(table.tree[node][1+int(state)])
+	}
+
+	for word := range table.match[0][state] {
+		matching := table.match[0][state][word]
+
+		for idx, position := range table.Neighbors {
+			matching &= table.match[idx+1][neighbors[position]][word]
+		}
+
+		if matching != 0 {
+			return table.outputs[word*64+bits.TrailingZeros64(matching)]
+		}
+	}
+
+	return state
+}
+
+// Load a rule: either  a rule file, a rule file  named like the rule
+// found in dir,  or a rule  string. A topology suffix may follow the
+// name of a rule file as well.
+func LoadRule(rule, dir string) (*Rule, error) {
+	name, suffix, found := strings.Cut(rule, ":")
+
+	filename := name
+	if !IsRuleFile(filename) {
+		filename = filepath.Join(dir, name+RULE_SUFFIX)
+
+		if _, err := os.Stat(filename); err != nil {
+			return ParseGameRule(rule)
+		}
+	}
+
+	golrule, err := LoadRuleFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if found {
+		golrule.Topology, err = ParseTopology(rule, suffix)
+		if err != nil {
+			return nil, err
+		}
+
+		golrule.Definition += ":" + golrule.Topology.String()
+	}
+
+	return golrule, nil
+}
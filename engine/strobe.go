@@ -0,0 +1,150 @@
+package engine
+
+// B0 rules, see https://golly.sourceforge.io/Help/Algorithms/QuickLife.html
+//
+// With  a rule  like B0123478/S01234678  dead cells  without any life
+// neighbor are being  born, so the empty background turns  alive in the
+// next generation.  Without S8  it dies  again after  that, the  whole
+// universe flashes.  Computing that directly  doesn't work on unbounded
+// universes and produces nonsense at the edges of bounded ones.
+//
+// We do it the way Golly does: the background is always stored as dead.
+// If it is alive, we store the complement of the cells and remember the
+// universe as inverted. The rule used to compute the next generation
+// is derived from  the real one depending on the  current and the next
+// phase, none of those derived rules contain B0. Without S8 the phases
+// alternate, with S8  the universe stays inverted after  the first
+// generation. Bounded universes behave like  a window into an infinite
+// universe: the cells outside have the state of the background.
+//
+// Only rules with two states are supported that way, B0 Generations and
+// Larger than Life rules are computed as they are, just like rule files.
+
+// keeps track of the phase of a universe using a B0 rule
+type Strobe struct {
+	Rule     *Rule       // the real rule
+	Inverted bool        // the stored cells are the complement of the real ones
+	rules    [2][2]*Rule // derived rules, indexed by the current and the next phase
+}
+
+// true if the rule needs to be computed using inverted phases
+func (rule *Rule) Strobes() bool {
+	return rule.HasB0() && !rule.IsGenerations() && !rule.IsLargerThanLife()
+}
+
+// setup the derived rules.  A universe which is already inverted stays
+// inverted, the new rule will be applied to the real cells.
+func (strobe *Strobe) SetRule(rule *Rule) {
+	strobe.Rule = rule
+
+	if rule.IsGenerations() || rule.IsLargerThanLife() || rule.Table != nil {
+		strobe.Inverted = false
+		strobe.rules = [2][2]*Rule{{rule, rule}, {rule, rule}}
+
+		return
+	}
+
+	for current := range strobe.rules {
+		for next := range strobe.rules[current] {
+			strobe.rules[current][next] = rule.Complement(current == 1, next == 1)
+		}
+	}
+}
+
+// true if rules have to be switched between generations
+func (strobe *Strobe) Active() bool {
+	return strobe.Inverted || strobe.Rule.Strobes()
+}
+
+// return the rule to compute the next generation with and move on to
+// the next phase
+func (strobe *Strobe) Next() *Rule {
+	next := strobe.NextInverted()
+	rule := strobe.rules[bool2int(strobe.Inverted)][bool2int(next)]
+
+	strobe.Inverted = next
+
+	return rule
+}
+
+// true if the background  will be alive in the next  generation: a dead
+// background is born  with 0 neighbors, an alive  one survives with all
+// of them
+func (strobe *Strobe) NextInverted() bool {
+	if strobe.Inverted {
+		return strobe.Rule.Survives(strobe.Rule.Crowded())
+	}
+
+	return strobe.Rule.Born(0)
+}
+
+// neighbors of a cell surrounded by life cells only, a count or a mask
+func (rule *Rule) Crowded() uint8 {
+	if rule.NonTotalistic {
+		return 0xff
+	}
+
+	return 8
+}
+
+// derive a  rule working on  complemented cells. If  input is set, the
+// cells passed to  the rule are stored inverted, if  output is set, the
+// resulting cells will  be stored inverted. The number  of neighbors of
+// inverted cells is  8 minus the real ones, for  masks it's the complement.
+func (rule *Rule) Complement(input, output bool) *Rule {
+	if !input && !output {
+		return rule
+	}
+
+	derived := &Rule{
+		Definition:    rule.Definition + " (complement)",
+		States:        2,
+		NonTotalistic: rule.NonTotalistic,
+		Neighborhood:  rule.Neighborhood,
+		Birth:         []uint8{},
+		Death:         []uint8{},
+	}
+
+	// compute the next stored state using the real rule
+	compute := func(state uint8, neighbors uint8) bool {
+		if input {
+			state ^= Alive
+
+			if rule.NonTotalistic {
+				neighbors = ^neighbors
+			} else {
+				neighbors = 8 - neighbors
+			}
+		}
+
+		alive := rule.CheckRuleGeneric(state, neighbors) == Alive
+
+		return alive != output
+	}
+
+	if rule.NonTotalistic {
+		for mask := 0; mask < 256; mask++ {
+			derived.BirthTable[mask] = compute(Dead, uint8(mask))
+			derived.SurviveTable[mask] = compute(Alive, uint8(mask))
+		}
+
+		// the counts are only used to check for B0
+		if derived.BirthTable[0] {
+			derived.Birth = append(derived.Birth, 0)
+		}
+
+		return derived
+	}
+
+	for count := uint8(0); count <= 8; count++ {
+		if compute(Dead, count) {
+			derived.Birth = append(derived.Birth, count)
+		}
+
+		if compute(Alive, count) {
+			derived.Death = append(derived.Death, count)
+		}
+	}
+
+	return derived
+}
@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Golly style bounded grids, see
+// https://golly.sourceforge.io/Help/bounded.html
+//
+// A rule may end with a suffix like :T100,80, which defines the size of
+// the grid and how its edges are joined:
+//
+//	:P100,80   plane, cells outside are dead
+//	:T100,80   torus, opposite edges are joined
+//	:K100*,80  Klein bottle, the asterisk marks the twisted pair of edges:
+//	           after the width the top and bottom edges are joined with
+//	           a twist, after the height the left and right edges
+//	:C100,80   cross-surface, both pairs of edges are twisted
+//	:S100      sphere, the top edge is joined to the left one and the
+//	           bottom edge to the right one, width and height must be equal
+//
+// The size may be omitted except for the Klein bottle, the size of the
+// grid is used then. A single number is used for both width and height.
+// Shifted edges and infinite dimensions are not supported.
+
+const (
+	PLANE_TOPOLOGY = 'P'
+	TORUS          = 'T'
+	KLEIN_BOTTLE   = 'K'
+	CROSS_SURFACE  = 'C'
+	SPHERE         = 'S'
+)
+
+type Topology struct {
+	Kind          byte // one of the above, 0 if the rule has no suffix
+	Width, Height int  // 0 if not given
+	FlipX         bool // crossing the top or bottom edge mirrors the x coordinate
+	FlipY         bool // crossing the left or right edge mirrors the y coordinate
+}
+
+// parse the topology suffix of a rule, without the colon
+func ParseTopology(rule, suffix string) (Topology, error) {
+	if suffix == "" {
+		return Topology{}, fmt.Errorf("missing topology after : in game rule <%s>", rule)
+	}
+
+	topology := Topology{Kind: strings.ToUpper(suffix)[0]}
+
+	switch topology.Kind {
+	case PLANE_TOPOLOGY, TORUS, KLEIN_BOTTLE, CROSS_SURFACE, SPHERE:
+	default:
+		return Topology{}, fmt.Errorf("invalid topology <%s> in game rule <%s>, expecting one of P, T, K, C or S",
+			suffix, rule)
+	}
+
+	size := suffix[1:]
+	if size == "" {
+		if topology.Kind == KLEIN_BOTTLE {
+			return Topology{}, fmt.Errorf("the Klein bottle in game rule <%s> needs a size like :K100*,80", rule)
+		}
+
+		topology.FlipX = topology.Kind == CROSS_SURFACE
+		topology.FlipY = topology.Kind == CROSS_SURFACE
+
+		return topology, nil
+	}
+
+	width, height, found := strings.Cut(size, ",")
+	if !found {
+		height = width
+	}
+
+	var err error
+
+	if topology.Width, topology.FlipX, err = ParseTopologySize(rule, width); err != nil {
+		return Topology{}, err
+	}
+
+	if topology.Height, topology.FlipY, err = ParseTopologySize(rule, height); err != nil {
+		return Topology{}, err
+	}
+
+	switch topology.Kind {
+	case KLEIN_BOTTLE:
+		if topology.FlipX == topology.FlipY {
+			return Topology{}, fmt.Errorf("the Klein bottle in game rule <%s> needs exactly one asterisk", rule)
+		}
+	case CROSS_SURFACE:
+		topology.FlipX = true
+		topology.FlipY = true
+	default:
+		if topology.FlipX || topology.FlipY {
+			return Topology{}, fmt.Errorf("only the Klein bottle in game rule <%s> may contain an asterisk", rule)
+		}
+	}
+
+	if topology.Kind == SPHERE && topology.Width != topology.Height {
+		return Topology{}, fmt.Errorf("the sphere in game rule <%s> must be square", rule)
+	}
+
+	return topology, nil
+}
+
+// parse a width or height, which may be followed by an asterisk
+func ParseTopologySize(rule, size string) (int, bool, error) {
+	twisted := strings.HasSuffix(size, "*")
+	size = strings.TrimSuffix(size, "*")
+
+	number, err := strconv.Atoi(size)
+	if err != nil || number < 1 {
+		return 0, false, fmt.Errorf("invalid grid size <%s> in game rule <%s>, shifts and infinite sizes are not supported",
+			size, rule)
+	}
+
+	return number, twisted, nil
+}
+
+// the topology in canonical form like T100,80 or K100*,80
+func (topology Topology) String() string {
+	if topology.Width == 0 {
+		return string(topology.Kind)
+	}
+
+	var width, height string
+
+	if topology.Kind == KLEIN_BOTTLE && topology.FlipX {
+		width = "*"
+	}
+
+	if topology.Kind == KLEIN_BOTTLE && topology.FlipY {
+		height = "*"
+	}
+
+	if topology.Kind == SPHERE {
+		return fmt.Sprintf("%c%d", topology.Kind, topology.Width)
+	}
+
+	return fmt.Sprintf("%c%d%s,%d%s", topology.Kind, topology.Width, width, topology.Height, height)
+}
+
+// true if the edges of a grid are joined in any other way than a torus
+func (topology Topology) Twisted() bool {
+	switch topology.Kind {
+	case KLEIN_BOTTLE, CROSS_SURFACE, SPHERE:
+		return true
+	}
+
+	return false
+}
+
+// map  the coordinates of a cell  outside of a wrapping grid  to the
+// cell inside  it, returns false if  there is no such cell,  which may
+// happen in the corners of a sphere
+func (topology Topology) Map(x, y, width, height int) (int, int, bool) {
+	if !topology.Twisted() {
+		return ((x % width) + width) % width, ((y % height) + height) % height, true
+	}
+
+	// large neighborhoods may need more than one step
+	for steps := 0; steps < 8; steps++ {
+		switch {
+		case x >= 0 && y >= 0 && x < width && y < height:
+			return x, y, true
+		case topology.Kind == SPHERE:
+			switch {
+			case y < 0:
+				x, y = -y-1, x
+			case y >= height:
+				x, y = width-(y-height+1), x
+			case x < 0:
+				x, y = y, -x-1
+			default:
+				x, y = y, height-(x-width+1)
+			}
+		case y < 0 || y >= height:
+			// every crossing of a twisted edge mirrors the cell
+			crossings := FloorDiv(y, height)
+			y -= crossings * height
+
+			if topology.FlipX && crossings%2 != 0 {
+				x = width - 1 - x
+			}
+		default:
+			crossings := FloorDiv(x, width)
+			x -= crossings * width
+
+			if topology.FlipY && crossings%2 != 0 {
+				y = height - 1 - y
+			}
+		}
+	}
+
+	return 0, 0, false
+}
+
+// integer division rounding towards negative infinity
+func FloorDiv(value, divisor int) int {
+	if value < 0 {
+		return (value - divisor + 1) / divisor
+	}
+
+	return value / divisor
+}
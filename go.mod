@@ -3,8 +3,11 @@ module github.com/tlinden/golsky
 go 1.22
 
 require (
+	github.com/ebitenui/ebitenui v0.5.8-0.20240608175527-424f62327b21
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/hajimehoshi/ebiten/v2 v2.7.4
 	github.com/spf13/pflag v1.0.5
+	github.com/tinne26/etxt v0.0.8
 	golang.org/x/image v0.16.0
 )
 
@@ -13,11 +16,8 @@ require (
 	github.com/ebitengine/gomobile v0.0.0-20240518074828-e86332849895 // indirect
 	github.com/ebitengine/hideconsole v1.0.0 // indirect
 	github.com/ebitengine/purego v0.7.0 // indirect
-	github.com/ebitenui/ebitenui v0.5.8-0.20240608175527-424f62327b21 // indirect
-	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0 // indirect
 	github.com/jezek/xgb v1.1.1 // indirect
 	github.com/mlange-42/arche v0.13.0 // indirect
-	github.com/tinne26/etxt v0.0.8 // indirect
 	golang.org/x/exp v0.0.0-20240222234643-814bf88cf225 // indirect
 	golang.org/x/sync v0.7.0 // indirect
 	golang.org/x/sys v0.20.0 // indirect
@@ -0,0 +1,202 @@
+package rle
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Plaintext  patterns as  distributed  by LifeWiki,  see
+// https://conwaylife.com/wiki/Plaintext
+//
+//	!Name: Glider
+//	!Author: Richard K. Guy
+//	!The smallest, most common, and first discovered spaceship.
+//	.O
+//	..O
+//	OOO
+//
+// Lines starting with ! are comments, every other line is a row of
+// cells, where . is dead and O is alive. Rows may be shorter than the
+// pattern, the missing cells are dead.
+
+// pattern file formats
+const (
+	FORMAT_RLE   = "rle"
+	FORMAT_CELLS = "cells"
+	FORMAT_LIF   = "lif"
+)
+
+// parse a plaintext pattern, * is accepted for alive cells as well
+func ParseCells(input string) (RLE, error) {
+	cells := RLE{}
+	lines := strings.Split(strings.TrimSuffix(strings.ReplaceAll(input, "\r", ""), "\n"), "\n")
+
+	for index, line := range lines {
+		if comment, found := strings.CutPrefix(line, "!"); found {
+			switch {
+			case strings.HasPrefix(comment, "Name:"):
+				cells.Name = strings.TrimSpace(strings.TrimPrefix(comment, "Name:"))
+			case strings.HasPrefix(comment, "Author:"):
+				cells.Author = strings.TrimSpace(strings.TrimPrefix(comment, "Author:"))
+			default:
+				cells.Comments = append(cells.Comments, strings.TrimSpace(comment))
+			}
+
+			continue
+		}
+
+		row := make([]int, len(line))
+
+		for column, char := range []byte(line) {
+			switch char {
+			case '.':
+			case 'O', '*':
+				row[column] = 1
+			default:
+				return RLE{}, &ParseError{Line: index + 1, Column: column + 1,
+					Message: fmt.Sprintf("invalid character <%c>", char)}
+			}
+		}
+
+		cells.Width = max(cells.Width, len(row))
+		cells.Pattern = append(cells.Pattern, row)
+
+		if cells.Width*len(cells.Pattern) > MAX_PATTERN_CELLS {
+			return RLE{}, &ParseError{Line: index + 1, Column: 1,
+				Message: fmt.Sprintf("pattern exceeds %d cells", MAX_PATTERN_CELLS)}
+		}
+	}
+
+	// all rows have the same length, like in RLE patterns
+	for y, row := range cells.Pattern {
+		if len(row) < cells.Width {
+			cells.Pattern[y] = append(row, make([]int, cells.Width-len(row))...)
+		}
+	}
+
+	cells.Height = len(cells.Pattern)
+
+	return cells, nil
+}
+
+// write the cells inside the bounds of the grid as plaintext, all
+// states other than dead are written as alive cells. Dead cells at the
+// end of a row are left out.
+func EncodeCells(writer io.Writer, grid Grid, meta *RLE) error {
+	buffer := bufio.NewWriter(writer)
+
+	if meta != nil {
+		if meta.Name != "" {
+			fmt.Fprintf(buffer, "!Name: %s\n", meta.Name)
+		}
+
+		if meta.Author != "" {
+			fmt.Fprintf(buffer, "!Author: %s\n", meta.Author)
+		}
+
+		for _, comment := range meta.Comments {
+			fmt.Fprintf(buffer, "!%s\n", comment)
+		}
+	}
+
+	bounds := grid.Bounds()
+	row := make([]byte, 0, bounds.Dx())
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		row = row[:0]
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if grid.Get(x, y) != 0 {
+				row = append(row, 'O')
+			} else {
+				row = append(row, '.')
+			}
+		}
+
+		end := len(row)
+		for end > 0 && row[end-1] == '.' {
+			end--
+		}
+
+		// empty rows keep one cell, so they don't look like a
+		// truncated file
+		if end == 0 && len(row) > 0 {
+			end = 1
+		}
+
+		buffer.Write(append(row[:end], '\n'))
+	}
+
+	return buffer.Flush()
+}
+
+// Store a grid to a plaintext file, see StoreGridToRLE
+func StoreGridToCells(grid Grid, filename string, meta *RLE) (err error) {
+	fd, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	header := RLE{Name: filename}
+	if meta != nil {
+		header = *meta
+
+		if header.Name == "" {
+			header.Name = filename
+		}
+	}
+
+	return EncodeCells(fd, grid, &header)
+}
+
+// guess the format of a pattern file by its content, the filename is
+// only used if the content is ambiguous
+func DetectFormat(content, filename string) string {
+	comments := false
+
+lines:
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+		case strings.HasPrefix(line, "#Life"):
+			return FORMAT_LIF
+		case strings.HasPrefix(line, "!"):
+			return FORMAT_CELLS
+		case strings.HasPrefix(removeWhitespace(line), "x="):
+			return FORMAT_RLE
+		case strings.HasPrefix(line, "#"):
+			// RLE and Life 1.05 comments look the same
+			comments = true
+		case strings.Trim(line, ".O*") == "":
+			// rows of cells after # comments without a header
+			if comments {
+				return FORMAT_LIF
+			}
+
+			return FORMAT_CELLS
+		default:
+			break lines
+		}
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".lif", ".life":
+		return FORMAT_LIF
+	case ".cells":
+		return FORMAT_CELLS
+	}
+
+	return FORMAT_RLE
+}
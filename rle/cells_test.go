@@ -0,0 +1,78 @@
+package rle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCells(t *testing.T) {
+	input := `!Name: Glider
+!Author: Richard K. Guy
+!The smallest, most common, and first discovered spaceship.
+.O
+..O
+OOO
+
+*.
+`
+
+	pattern, err := ParseCells(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]int{
+		{0, 1, 0},
+		{0, 0, 1},
+		{1, 1, 1},
+		{0, 0, 0},
+		{1, 0, 0},
+	}
+
+	if !reflect.DeepEqual(pattern.Pattern, expected) {
+		t.Errorf("unexpected pattern: %v", pattern.Pattern)
+	}
+
+	if pattern.Width != 3 || pattern.Height != 5 || pattern.Name != "Glider" || pattern.Author != "Richard K. Guy" ||
+		!reflect.DeepEqual(pattern.Comments, []string{"The smallest, most common, and first discovered spaceship."}) {
+		t.Errorf("unexpected metadata: %+v", pattern)
+	}
+
+	if _, err := ParseCells(".O\n..o\n"); err == nil || err.Error() != "line 2, column 3: invalid character <o>" {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	var output strings.Builder
+
+	cells := Cells{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}, {0, 0, 0}, {2, 0, 0}}
+	if err := EncodeCells(&output, cells, &pattern); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != strings.ReplaceAll(input, "\n\n*.", "\n.\nO") {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		content, filename, expected string
+	}{
+		{"#N Glider\nx = 3, y = 3\nbo$2bo$3o!", "glider.cells", FORMAT_RLE},
+		{"x=3,y=3\nbo$2bo$3o!", "", FORMAT_RLE},
+		{"!Name: Glider\n.O\n..O\nOOO", "glider.rle", FORMAT_CELLS},
+		{"\n.O\n..O\nOOO", "glider", FORMAT_CELLS},
+		{"#Life 1.05\n#P 0 0\n.*\n..*\n***", "glider.rle", FORMAT_LIF},
+		{"#D glider\n.*\n..*\n***", "glider", FORMAT_LIF},
+		{"something else", "glider.cells", FORMAT_CELLS},
+		{"something else", "glider.lif", FORMAT_LIF},
+		{"", "glider", FORMAT_RLE},
+	}
+
+	for _, test := range tests {
+		if format := DetectFormat(test.content, test.filename); format != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.content, test.expected, format)
+		}
+	}
+}
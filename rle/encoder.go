@@ -0,0 +1,155 @@
+package rle
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+)
+
+// Canonical RLE output, like Golly writes it: runs of dead cells at the
+// end of a row are left out, empty rows are merged into a single N$,
+// empty rows at the end are left out as well and no line is longer than
+// 70 characters. Runs are never split across lines.
+
+const LINE_LENGTH = 70
+
+// the cells to encode, engine universes satisfy it
+type Grid interface {
+	Bounds() image.Rectangle
+	Get(x, y int) uint8
+}
+
+// a grid made of rows of cells
+type Cells [][]uint8
+
+func (cells Cells) Bounds() image.Rectangle {
+	if len(cells) == 0 {
+		return image.Rectangle{}
+	}
+
+	return image.Rect(0, 0, len(cells[0]), len(cells))
+}
+
+func (cells Cells) Get(x, y int) uint8 {
+	return cells[y][x]
+}
+
+type Encoder struct {
+	writer *bufio.Writer
+	column int // length of the current line
+}
+
+func NewEncoder(writer io.Writer) *Encoder {
+	return &Encoder{writer: bufio.NewWriter(writer)}
+}
+
+// write the cells inside the bounds of the grid, the # lines are taken
+// from meta, which may be nil
+func (encoder *Encoder) Encode(grid Grid, rule string, meta *RLE) error {
+	bounds := grid.Bounds()
+	multistate := IsMultiState(grid)
+
+	if meta != nil {
+		encoder.writer.WriteString(meta.Header())
+	}
+
+	fmt.Fprintf(encoder.writer, "x = %d, y = %d", bounds.Dx(), bounds.Dy())
+	if rule != "" {
+		fmt.Fprintf(encoder.writer, ", rule = %s", rule)
+	}
+	encoder.writer.WriteString("\n")
+
+	encoder.column = 0
+	rows := 0 // row ends not written yet
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		state, count := uint8(0), 0
+		written := false
+
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			current := grid.Get(x, y)
+
+			if current == state {
+				count++
+				continue
+			}
+
+			if count > 0 {
+				if !written {
+					encoder.emit(rows, "$")
+					rows = 0
+					written = true
+				}
+
+				encoder.emit(count, StateLetters(int(state), multistate))
+			}
+
+			state, count = current, 1
+		}
+
+		// dead cells at the end of the row are left out
+		if state != 0 {
+			if !written {
+				encoder.emit(rows, "$")
+				rows = 0
+			}
+
+			encoder.emit(count, StateLetters(int(state), multistate))
+		}
+
+		rows++
+	}
+
+	encoder.emit(1, "!")
+	encoder.writer.WriteString("\n")
+
+	return encoder.writer.Flush()
+}
+
+// write a run, it goes to the next line if it doesn't fit
+func (encoder *Encoder) emit(count int, letters string) {
+	if count == 0 {
+		return
+	}
+
+	run := letters
+	if count > 1 {
+		run = fmt.Sprintf("%d%s", count, letters)
+	}
+
+	if encoder.column > 0 && encoder.column+len(run) > LINE_LENGTH {
+		encoder.writer.WriteString("\n")
+		encoder.column = 0
+	}
+
+	encoder.writer.WriteString(run)
+	encoder.column += len(run)
+}
+
+// true if the grid contains states other than dead or alive, which
+// require multi-state letters. Grids which can walk their cells only
+// visit the non-dead ones.
+func IsMultiState(grid Grid) bool {
+	bounds := grid.Bounds()
+
+	if walker, ok := grid.(Walker); ok {
+		multistate := false
+
+		walker.Each(bounds, func(x, y int) {
+			multistate = multistate || grid.Get(x, y) > 1
+		})
+
+		return multistate
+	}
+
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if grid.Get(x, y) > 1 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,105 @@
+package rle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	tests := []struct {
+		name     string
+		cells    Cells
+		rule     string
+		expected string
+	}{
+		{
+			name:     "glider",
+			cells:    Cells{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}},
+			rule:     "B3/S23",
+			expected: "x = 3, y = 3, rule = B3/S23\nbo$2bo$3o!\n",
+		},
+		{
+			name: "empty rows and trailing dead cells",
+			cells: Cells{
+				{0, 0, 0, 0},
+				{1, 1, 0, 0},
+				{0, 0, 0, 0},
+				{0, 0, 0, 0},
+				{0, 0, 0, 1},
+				{0, 0, 0, 0},
+			},
+			expected: "x = 4, y = 6\n$2o3$3bo!\n",
+		},
+		{
+			name:     "multi-state",
+			cells:    Cells{{0, 1, 2, 0}, {0, 0, 1, 0}, {25, 0, 0, 3}},
+			rule:     "B2/S/C3",
+			expected: "x = 4, y = 3, rule = B2/S/C3\n.AB$2.A$pA2.C!\n",
+		},
+		{
+			name:     "empty",
+			cells:    Cells{{0, 0}, {0, 0}},
+			expected: "x = 2, y = 2\n!\n",
+		},
+	}
+
+	for _, test := range tests {
+		var output strings.Builder
+
+		if err := NewEncoder(&output).Encode(test.cells, test.rule, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		if output.String() != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.name, test.expected, output.String())
+		}
+	}
+}
+
+func TestEncoderWrap(t *testing.T) {
+	cells := make(Cells, 30)
+	for y := range cells {
+		cells[y] = make([]uint8, 100)
+
+		for x := range cells[y] {
+			if (x*7+y*3)%5 < 2 {
+				cells[y][x] = 1
+			}
+		}
+	}
+
+	var output strings.Builder
+
+	if err := NewEncoder(&output).Encode(cells, "B3/S23", &RLE{Name: "stripes"}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+	if lines[0] != "#N stripes" {
+		t.Errorf("unexpected first line: %s", lines[0])
+	}
+
+	for _, line := range lines[2:] {
+		if len(line) > LINE_LENGTH {
+			t.Errorf("line exceeds %d characters: %s", LINE_LENGTH, line)
+		}
+	}
+
+	pattern, err := Parse(output.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for y, row := range pattern.Pattern {
+		for x, state := range row {
+			if uint8(state) != cells[y][x] {
+				t.Fatalf("cell %d,%d differs", x, y)
+			}
+		}
+	}
+
+	if !reflect.DeepEqual([]int{pattern.Width, pattern.Height}, []int{100, 30}) {
+		t.Errorf("unexpected size %dx%d", pattern.Width, pattern.Height)
+	}
+}
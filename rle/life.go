@@ -0,0 +1,386 @@
+package rle
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Life 1.05 and 1.06 files, see https://conwaylife.com/wiki/Life_1.05
+// and https://conwaylife.com/wiki/Life_1.06
+//
+// Life 1.05 files consist of blocks of rows made of . and *, every
+// block starts with #P x y, its top left corner. #D lines are
+// comments, #N selects the normal Life rules, #R sets the rule.
+//
+//	#Life 1.05
+//	#D two gliders
+//	#P -1 -1
+//	.*
+//	..*
+//	***
+//	#P 10 -1
+//	***
+//
+// Life 1.06 files list the coordinates of every alive cell, which is
+// compact for large sparse patterns.
+//
+//	#Life 1.06
+//	0 -1
+//	1 0
+//	-1 1
+//	0 1
+//	1 1
+//
+// Both keep the coordinates in Offset, the top left corner of the
+// pattern. #D and #R lines are accepted by the 1.06 reader as well.
+
+const (
+	LIFE_105 = "1.05"
+	LIFE_106 = "1.06"
+
+	LIFE_RULE = "B3/S23" // the rule of #N
+
+	MAX_COORDINATE = 1 << 30
+)
+
+// grids which can visit their alive cells directly, like the engine
+// universes, so sparse grids can be written without looking at every
+// dead cell
+type Walker interface {
+	Each(rect image.Rectangle, action func(x, y int))
+}
+
+// a block of rows of a Life 1.05 file
+type lifeBlock struct {
+	origin image.Point
+	rows   [][]int
+	width  int
+}
+
+// parse a Life 1.05 or 1.06 pattern, files without header are read as
+// 1.05, unless they start with coordinates
+func ParseLife(input string) (RLE, error) {
+	lines := strings.Split(strings.ReplaceAll(input, "\r", ""), "\n")
+
+detect:
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(line, "#Life 1.06"):
+			return parseLife106(lines)
+		case line == "", strings.HasPrefix(line, "#"):
+		case isCoordinate(line):
+			return parseLife106(lines)
+		default:
+			break detect
+		}
+	}
+
+	return parseLife105(lines)
+}
+
+func parseLife105(lines []string) (RLE, error) {
+	life := RLE{}
+	blocks := []*lifeBlock{}
+
+	var block *lifeBlock
+
+	for index, line := range lines {
+		line = strings.TrimSpace(line)
+
+		if strings.HasPrefix(line, "#") {
+			if strings.HasPrefix(line, "#P") {
+				var x, y int
+
+				if _, err := fmt.Sscanf(line[2:], "%d %d", &x, &y); err != nil || !isValidPoint(x, y) {
+					return RLE{}, &ParseError{Line: index + 1, Column: 1,
+						Message: fmt.Sprintf("invalid offset <%s>", line)}
+				}
+
+				block = &lifeBlock{origin: image.Pt(x, y)}
+				blocks = append(blocks, block)
+				life.Positioned = true
+
+				continue
+			}
+
+			parseLifeComment(&life, line)
+
+			continue
+		}
+
+		if line == "" {
+			continue
+		}
+
+		if block == nil {
+			// cells before the first #P start at the origin
+			block = &lifeBlock{}
+			blocks = append(blocks, block)
+		}
+
+		row := make([]int, len(line))
+
+		for column, char := range []byte(line) {
+			switch char {
+			case '.':
+			case '*', 'o', 'O':
+				row[column] = 1
+			default:
+				return RLE{}, &ParseError{Line: index + 1, Column: column + 1,
+					Message: fmt.Sprintf("invalid character <%c>", char)}
+			}
+		}
+
+		block.rows = append(block.rows, row)
+		block.width = max(block.width, len(row))
+
+		if block.width*len(block.rows) > MAX_PATTERN_CELLS {
+			return RLE{}, &ParseError{Line: index + 1, Column: 1,
+				Message: fmt.Sprintf("pattern exceeds %d cells", MAX_PATTERN_CELLS)}
+		}
+	}
+
+	// the pattern covers all blocks, including their dead cells, so a
+	// saved grid keeps its size
+	var bounds image.Rectangle
+
+	for idx, block := range blocks {
+		rect := image.Rect(0, 0, block.width, len(block.rows)).Add(block.origin)
+
+		if idx == 0 {
+			bounds = rect
+		} else {
+			bounds = bounds.Union(rect)
+		}
+	}
+
+	if !life.fit(bounds) {
+		return RLE{}, fmt.Errorf("pattern exceeds %d cells", MAX_PATTERN_CELLS)
+	}
+
+	for _, block := range blocks {
+		for y, row := range block.rows {
+			for x, state := range row {
+				if state != 0 {
+					life.Pattern[block.origin.Y+y-bounds.Min.Y][block.origin.X+x-bounds.Min.X] = state
+				}
+			}
+		}
+	}
+
+	return life, nil
+}
+
+func parseLife106(lines []string) (RLE, error) {
+	life := RLE{Positioned: true}
+	cells := []image.Point{}
+
+	var bounds image.Rectangle
+
+	for index, line := range lines {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			parseLifeComment(&life, line)
+			continue
+		}
+
+		var x, y int
+
+		if _, err := fmt.Sscanf(line, "%d %d", &x, &y); err != nil || !isValidPoint(x, y) {
+			return RLE{}, &ParseError{Line: index + 1, Column: 1,
+				Message: fmt.Sprintf("invalid coordinates <%s>", line)}
+		}
+
+		cell := image.Rect(x, y, x+1, y+1)
+
+		if len(cells) == 0 {
+			bounds = cell
+		} else {
+			bounds = bounds.Union(cell)
+		}
+
+		if isTooLarge(bounds) {
+			return RLE{}, &ParseError{Line: index + 1, Column: 1,
+				Message: fmt.Sprintf("pattern exceeds %d cells", MAX_PATTERN_CELLS)}
+		}
+
+		cells = append(cells, image.Pt(x, y))
+	}
+
+	life.fit(bounds)
+
+	for _, cell := range cells {
+		life.Pattern[cell.Y-bounds.Min.Y][cell.X-bounds.Min.X] = 1
+	}
+
+	return life, nil
+}
+
+// the # lines of Life files, unknown ones are ignored
+func parseLifeComment(life *RLE, line string) {
+	switch {
+	case strings.HasPrefix(line, "#D"):
+		life.Comments = append(life.Comments, strings.TrimSpace(line[2:]))
+	case strings.HasPrefix(line, "#N"):
+		life.Rule = LIFE_RULE
+	case strings.HasPrefix(line, "#R"):
+		life.Rule = strings.TrimSpace(line[2:])
+	}
+}
+
+// size the pattern to the given bounds, false if it is too large
+func (rle *RLE) fit(bounds image.Rectangle) bool {
+	if isTooLarge(bounds) {
+		return false
+	}
+
+	rle.Offset = bounds.Min
+	rle.Width = bounds.Dx()
+	rle.Height = bounds.Dy()
+	rle.Pattern = make([][]int, rle.Height)
+
+	for y := range rle.Pattern {
+		rle.Pattern[y] = make([]int, rle.Width)
+	}
+
+	return true
+}
+
+func isTooLarge(bounds image.Rectangle) bool {
+	return bounds.Dx() > MAX_PATTERN_CELLS || bounds.Dy() > MAX_PATTERN_CELLS ||
+		bounds.Dx()*bounds.Dy() > MAX_PATTERN_CELLS
+}
+
+// coordinates are limited, so computing the bounds can't overflow
+func isValidPoint(x, y int) bool {
+	return x >= -MAX_COORDINATE && x <= MAX_COORDINATE && y >= -MAX_COORDINATE && y <= MAX_COORDINATE
+}
+
+// true if the line consists of two numbers
+func isCoordinate(line string) bool {
+	var x, y int
+
+	_, err := fmt.Sscanf(line, "%d %d", &x, &y)
+
+	return err == nil
+}
+
+// write the cells inside the bounds of the grid as Life 1.05 or 1.06
+// file. Only alive cells are written, the comments are taken from meta,
+// which may be nil. Life 1.05 files consist of a single block covering
+// the bounds, so the size of the grid is kept. Life 1.06 files only
+// list the alive cells. Both only know dead and alive cells, so grids
+// with other states are rejected, see IsMultiState.
+func EncodeLife(writer io.Writer, grid Grid, rule, version string, meta *RLE) error {
+	if version != LIFE_105 && version != LIFE_106 {
+		return fmt.Errorf("invalid Life file version <%s>", version)
+	}
+
+	if IsMultiState(grid) {
+		return errors.New("Life files can only store dead and alive cells, use RLE")
+	}
+
+	buffer := bufio.NewWriter(writer)
+	bounds := grid.Bounds()
+
+	fmt.Fprintf(buffer, "#Life %s\n", version)
+
+	if rule != "" {
+		fmt.Fprintf(buffer, "#R %s\n", rule)
+	}
+
+	if meta != nil {
+		for _, comment := range meta.Comments {
+			fmt.Fprintf(buffer, "#D %s\n", comment)
+		}
+	}
+
+	switch version {
+	case LIFE_105:
+		fmt.Fprintf(buffer, "#P %d %d\n", bounds.Min.X, bounds.Min.Y)
+
+		row := make([]byte, bounds.Dx()+1)
+		row[len(row)-1] = '\n'
+
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				row[x-bounds.Min.X] = '.'
+				if grid.Get(x, y) == 1 {
+					row[x-bounds.Min.X] = '*'
+				}
+			}
+
+			buffer.Write(row)
+		}
+	case LIFE_106:
+		for _, cell := range AliveCells(grid) {
+			fmt.Fprintf(buffer, "%d %d\n", cell.X, cell.Y)
+		}
+	}
+
+	return buffer.Flush()
+}
+
+// the alive cells inside the bounds of the grid, ordered by rows
+func AliveCells(grid Grid) []image.Point {
+	bounds := grid.Bounds()
+	cells := []image.Point{}
+
+	collect := func(x, y int) {
+		if grid.Get(x, y) == 1 {
+			cells = append(cells, image.Pt(x, y))
+		}
+	}
+
+	walker, ok := grid.(Walker)
+	if !ok {
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				collect(x, y)
+			}
+		}
+
+		return cells
+	}
+
+	walker.Each(bounds, collect)
+
+	// the order of Each depends on the engine
+	slices.SortFunc(cells, func(a, b image.Point) int {
+		if a.Y != b.Y {
+			return a.Y - b.Y
+		}
+
+		return a.X - b.X
+	})
+
+	return cells
+}
+
+// Store a grid to a Life file, see EncodeLife
+func StoreGridToLife(grid Grid, filename, rule, version string, meta *RLE) (err error) {
+	fd, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	return EncodeLife(fd, grid, rule, version, meta)
+}
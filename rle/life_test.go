@@ -0,0 +1,209 @@
+package rle
+
+import (
+	"image"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLife105(t *testing.T) {
+	input := `#Life 1.05
+#D two blocks
+#N
+#P -1 -1
+.*
+..*
+***
+#P 3 2
+**
+`
+
+	pattern, err := ParseLife(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]int{
+		{0, 1, 0, 0, 0, 0},
+		{0, 0, 1, 0, 0, 0},
+		{1, 1, 1, 0, 0, 0},
+		{0, 0, 0, 0, 1, 1},
+	}
+
+	if !reflect.DeepEqual(pattern.Pattern, expected) {
+		t.Errorf("unexpected pattern: %v", pattern.Pattern)
+	}
+
+	if pattern.Width != 6 || pattern.Height != 4 || pattern.Offset != image.Pt(-1, -1) || !pattern.Positioned ||
+		pattern.Rule != LIFE_RULE || !reflect.DeepEqual(pattern.Comments, []string{"two blocks"}) {
+		t.Errorf("unexpected metadata: %+v", pattern)
+	}
+
+	// old state files without header, rule from #R
+	pattern, err = ParseLife("#R B36/S23\n.o.\n..o\nooo\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pattern.Rule != "B36/S23" || pattern.Positioned ||
+		!reflect.DeepEqual(pattern.Pattern, [][]int{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}}) {
+		t.Errorf("unexpected pattern: %+v", pattern)
+	}
+
+	for _, input := range []string{"#P 1\n*", "#P 0 0\n*x", "#P 0 0\n*\n#P 9999999999 0\n*"} {
+		if _, err := ParseLife(input); err == nil {
+			t.Errorf("invalid input accepted: %q", input)
+		}
+	}
+}
+
+func TestLife106(t *testing.T) {
+	for _, input := range []string{
+		"#Life 1.06\n#R B3/S23\n0 -1\n1 0\n-1 1\n0 1\n1 1\n",
+		"0 -1\n1 0\n-1 1\n0 1\n1 1", // without header
+	} {
+		pattern, err := ParseLife(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(pattern.Pattern, [][]int{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}}) ||
+			pattern.Offset != image.Pt(-1, -1) || !pattern.Positioned {
+			t.Errorf("unexpected pattern: %+v", pattern)
+		}
+	}
+
+	if _, err := ParseLife("#Life 1.06\n0 0\n1 x\n"); err == nil || err.Error() != "line 3, column 1: invalid coordinates <1 x>" {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// a sparse grid visiting its cells in reverse order
+type sparse map[image.Point]uint8
+
+func (grid sparse) Bounds() image.Rectangle {
+	var bounds image.Rectangle
+
+	for point := range grid {
+		bounds = bounds.Union(image.Rect(point.X, point.Y, point.X+1, point.Y+1))
+	}
+
+	return bounds
+}
+
+func (grid sparse) Get(x, y int) uint8 {
+	return grid[image.Pt(x, y)]
+}
+
+func (grid sparse) Each(rect image.Rectangle, action func(x, y int)) {
+	for y := rect.Max.Y - 1; y >= rect.Min.Y; y-- {
+		for x := rect.Max.X - 1; x >= rect.Min.X; x-- {
+			if grid.Get(x, y) != 0 {
+				action(x, y)
+			}
+		}
+	}
+}
+
+func TestEncodeLife(t *testing.T) {
+	grid := sparse{image.Pt(-5, 1000): 1, image.Pt(2000, -3): 1, image.Pt(7, -3): 1}
+	meta := &RLE{Comments: []string{"sparse"}}
+
+	var output strings.Builder
+
+	if err := EncodeLife(&output, grid, "B3/S23", LIFE_106, meta); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "#Life 1.06\n#R B3/S23\n#D sparse\n7 -3\n2000 -3\n-5 1000\n"
+	if output.String() != expected {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+
+	pattern, err := ParseLife(output.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pattern.Offset != image.Pt(-5, -3) || pattern.Width != 2006 || pattern.Height != 1004 ||
+		pattern.Pattern[0][12] != 1 || pattern.Pattern[1003][0] != 1 || pattern.Rule != "B3/S23" {
+		t.Errorf("unexpected pattern: %+v", pattern.Offset)
+	}
+
+	output.Reset()
+
+	cells := Cells{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}}
+	if err := EncodeLife(&output, cells, "B3/S23", LIFE_105, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if output.String() != "#Life 1.05\n#R B3/S23\n#P 0 0\n.*.\n..*\n***\n" {
+		t.Errorf("unexpected output:\n%s", output.String())
+	}
+
+	if err := EncodeLife(&output, cells, "B3/S23", "1.07", nil); err == nil {
+		t.Errorf("invalid version accepted")
+	}
+
+	// dying cells of Generations rules would get lost
+	grid[image.Pt(0, 0)] = 2
+
+	for _, version := range []string{LIFE_105, LIFE_106} {
+		for _, multistate := range []Grid{grid, Cells{{0, 1}, {2, 1}}} {
+			if err := EncodeLife(&output, multistate, "23/3/3", version, nil); err == nil {
+				t.Errorf("%s: multi-state grid accepted", version)
+			}
+		}
+	}
+}
+
+// a state of a bounded grid is saved relative to its center and loaded
+// at the same place
+func TestLifeStateRoundTrip(t *testing.T) {
+	width, height := 40, 30
+	center := image.Pt(width/2, height/2)
+	cells := []image.Point{image.Pt(3, 2), image.Pt(4, 3), image.Pt(2, 4), image.Pt(3, 4), image.Pt(4, 4),
+		image.Pt(30, 25)}
+
+	state := sparse{}
+	for _, cell := range cells {
+		state[cell.Sub(center)] = 1
+	}
+
+	var output strings.Builder
+
+	if err := EncodeLife(&output, state, "B3/S23", LIFE_106, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pattern, err := ParseLife(output.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origin := pattern.Origin(width, height, true)
+	loaded := []image.Point{}
+
+	for y, row := range pattern.Pattern {
+		for x, cell := range row {
+			if cell != 0 {
+				loaded = append(loaded, image.Pt(x, y).Add(origin))
+			}
+		}
+	}
+
+	if !reflect.DeepEqual(loaded, cells) {
+		t.Errorf("unexpected cells: %v", loaded)
+	}
+
+	// unbounded planes use the offset as it is, patterns which don't fit
+	// into a bounded grid are centered
+	if origin := pattern.Origin(width, height, false); origin != image.Pt(-18, -13) {
+		t.Errorf("unexpected origin: %v", origin)
+	}
+
+	if origin := pattern.Origin(10, 10, true); origin != image.Pt(5-14, 5-12) {
+		t.Errorf("unexpected origin: %v", origin)
+	}
+}
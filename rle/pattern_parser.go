@@ -1,6 +1,7 @@
 package rle
 
 import (
+	"fmt"
 	"strconv"
 )
 
@@ -9,25 +10,45 @@ type TokenType string
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // position of the token, starting at 1
+	Column  int
 }
 
 const (
 	RUN_COUNT  = "RUN_COUNT"
 	DEAD_CELL  = "DEAD_CELL"
 	ALIVE_CELL = "ALIVE_CELL"
+	STATE_CELL = "STATE_CELL" // multi-state cell: A-X, pA-yO for states > 24
 	EOL        = "EOL"
 	EOP        = "EOP"
+	EOF        = "EOF"     // end of input without !
+	ILLEGAL    = "ILLEGAL" // any character not allowed in a pattern
+
+	MAX_STATE         = 255
+	MAX_PATTERN_CELLS = 1 << 22 // larger patterns are rejected
 )
 
+// an error in an RLE file, with the position where it occurred
+type ParseError struct {
+	Line, Column int
+	Message      string
+}
+
+func (err *ParseError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", err.Line, err.Column, err.Message)
+}
+
 type Lexer struct {
 	input        string
 	position     int
 	readPosition int
 	char         byte
+	line         int
+	column       int
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	l := &Lexer{input: input, line: 1}
 	l.readChar()
 	return l
 }
@@ -37,23 +58,35 @@ func (l *Lexer) NextToken() Token {
 
 	l.skipWhitespace()
 
-	switch l.char {
-	case '$':
+	line, column := l.line, l.column
+
+	switch {
+	case l.position >= len(l.input):
+		return Token{Type: EOF, Line: line, Column: column}
+	case l.char == '$':
 		tok = newToken(EOL, l.char)
-	case '!':
+	case l.char == '!':
 		tok = newToken(EOP, l.char)
-	case 'b':
+	case l.char == 'b', l.char == '.':
 		tok = newToken(DEAD_CELL, l.char)
-	case 'o':
+	case l.char == 'o':
+		tok = newToken(ALIVE_CELL, l.char)
+	case isDigit(l.char):
+		return Token{Type: RUN_COUNT, Literal: l.readNumber(), Line: line, Column: column}
+	case isStateLetter(l.char):
+		tok = newToken(STATE_CELL, l.char)
+	case isStatePrefix(l.char) && isStateLetter(l.peekChar()):
+		tok = Token{Type: STATE_CELL, Literal: l.input[l.position : l.position+2]}
+		l.readChar()
+	case 'a' <= l.char && l.char <= 'z':
+		// like Golly, any other letter is an alive cell
 		tok = newToken(ALIVE_CELL, l.char)
 	default:
-		if isDigit(l.char) {
-			tok.Type = RUN_COUNT
-			tok.Literal = l.readNumber()
-			return tok
-		}
+		tok = newToken(ILLEGAL, l.char)
 	}
 
+	tok.Line, tok.Column = line, column
+
 	l.readChar()
 	return tok
 }
@@ -78,52 +111,154 @@ func NewParser(lexer *Lexer) *PatternParser {
 	return p
 }
 
-func (pp *PatternParser) ParsePattern(width, height int) [][]int {
-	result := make([][]int, height)
+// return the cell state represented by the token
+func CellState(tok Token) int {
+	switch tok.Type {
+	case ALIVE_CELL:
+		return 1
+	case STATE_CELL:
+		if len(tok.Literal) == 2 {
+			return 24*int(tok.Literal[0]-'p'+1) + int(tok.Literal[1]-'A') + 1
+		}
+
+		return int(tok.Literal[0]-'A') + 1
+	}
+
+	return 0
+}
+
+// return the RLE representation of a cell state, multi-state patterns
+// use '.' for dead cells and letters for all others
+func StateLetters(state int, multistate bool) string {
+	switch {
+	case !multistate && state == 0:
+		return "b"
+	case !multistate:
+		return "o"
+	case state == 0:
+		return "."
+	case state <= 24:
+		return string(rune('A' + state - 1))
+	}
+
+	state -= 25
+
+	return string([]rune{rune('p' + state/24), rune('A' + state%24)})
+}
+
+// parse the pattern into rows of the given size. Runs exceeding the
+// size enlarge the pattern, so the rows may be larger.  The final ! may
+// be missing.
+func (pp *PatternParser) ParsePattern(width, height int) ([][]int, error) {
+	if width < 0 || height < 0 || width > MAX_PATTERN_CELLS || height > MAX_PATTERN_CELLS ||
+		width*height > MAX_PATTERN_CELLS {
+		return nil, pp.error(pp.currentToken, "invalid pattern size <%dx%d>", width, height)
+	}
+
+	grid := &patternGrid{width: width, height: height, capacity: width, rows: make([][]int, height)}
+	for y := range grid.rows {
+		grid.rows[y] = make([]int, width)
+	}
+
+	var x, y int
 
-	row := make([]int, width)
-	var rowIndex int
-	var colIndex int
 	for {
-		switch pp.currentToken.Type {
-		case RUN_COUNT:
-			count, _ := strconv.Atoi(pp.currentToken.Literal)
-			for i := 0; i < count; i++ {
-				switch pp.peekToken.Type {
-				case ALIVE_CELL:
-					row[rowIndex+i] = 1
-				case DEAD_CELL:
-					row[rowIndex+i] = 0
-				case EOL:
-					result[colIndex] = row
-					row = make([]int, width)
-					rowIndex = -1
-					colIndex++
-				}
-			}
+		tok := pp.currentToken
+		count := 1
 
-			if pp.peekToken.Type != EOL {
-				rowIndex += count - 1
+		if tok.Type == RUN_COUNT {
+			number, err := strconv.Atoi(tok.Literal)
+			if err != nil || number < 1 || number > MAX_PATTERN_CELLS {
+				return nil, pp.error(tok, "invalid run count <%s>", tok.Literal)
 			}
+
+			count = number
 			pp.nextToken()
-		case ALIVE_CELL:
-			row[rowIndex] = 1
+			tok = pp.currentToken
+		}
+
+		switch tok.Type {
 		case DEAD_CELL:
-			row[rowIndex] = 0
+			x += count
+		case ALIVE_CELL, STATE_CELL:
+			state := CellState(tok)
+			if state > MAX_STATE {
+				return nil, pp.error(tok, "invalid cell state <%s>", tok.Literal)
+			}
+
+			if !grid.fit(x+count, y+1) {
+				return nil, pp.error(tok, "pattern exceeds %d cells", MAX_PATTERN_CELLS)
+			}
+
+			for end := x + count; x < end; x++ {
+				grid.rows[y][x] = state
+			}
 		case EOL:
-			result[colIndex] = row
-			row = make([]int, width)
-			rowIndex = -1
-			colIndex++
-		case EOP:
-			result[colIndex] = row
-			return result
+			x = 0
+			y += count
+		case EOP, EOF:
+			return grid.result(), nil
+		default:
+			return nil, pp.error(tok, "invalid character <%s>", tok.Literal)
 		}
-		rowIndex++
+
 		pp.nextToken()
 	}
 }
 
+func (pp *PatternParser) error(tok Token, format string, args ...any) error {
+	return &ParseError{Line: tok.Line, Column: tok.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+// the rows of a pattern being parsed, they grow if cells beyond the
+// declared size are set
+type patternGrid struct {
+	rows          [][]int
+	capacity      int // length of the rows
+	width, height int // the size in use
+}
+
+// make room for a cell at width-1,height-1, false if the pattern
+// would be too large
+func (grid *patternGrid) fit(width, height int) bool {
+	width = max(width, grid.width)
+	height = max(height, grid.height)
+
+	if width > MAX_PATTERN_CELLS || height > MAX_PATTERN_CELLS || width*height > MAX_PATTERN_CELLS {
+		return false
+	}
+
+	if width > grid.capacity {
+		// at least double it, so a long run of cells beyond the
+		// declared width doesn't copy all rows for every cell
+		grid.capacity = min(max(width, 2*grid.capacity), MAX_PATTERN_CELLS/height)
+
+		for y, row := range grid.rows {
+			grid.rows[y] = make([]int, grid.capacity)
+			copy(grid.rows[y], row)
+		}
+	}
+
+	for len(grid.rows) < height {
+		grid.rows = append(grid.rows, make([]int, grid.capacity))
+	}
+
+	grid.width, grid.height = width, height
+
+	return true
+}
+
+// the rows cut to the size in use
+func (grid *patternGrid) result() [][]int {
+	rows := grid.rows[:grid.height]
+
+	for y := range rows {
+		rows[y] = rows[y][:grid.width]
+	}
+
+	return rows
+}
+
 func (pp *PatternParser) nextToken() {
 	pp.currentToken = pp.peekToken
 	pp.peekToken = pp.lexer.NextToken()
@@ -134,6 +269,12 @@ func isDigit(char byte) bool {
 }
 
 func (l *Lexer) readChar() {
+	if l.char == '\n' {
+		l.line++
+		l.column = 0
+	}
+	l.column++
+
 	if l.readPosition >= len(l.input) {
 		l.char = 0
 	} else {
@@ -143,6 +284,22 @@ func (l *Lexer) readChar() {
 	l.readPosition++
 }
 
+func (l *Lexer) peekChar() byte {
+	if l.readPosition >= len(l.input) {
+		return 0
+	}
+
+	return l.input[l.readPosition]
+}
+
+func isStateLetter(char byte) bool {
+	return 'A' <= char && char <= 'X'
+}
+
+func isStatePrefix(char byte) bool {
+	return 'p' <= char && char <= 'y'
+}
+
 func (l *Lexer) readNumber() string {
 	position := l.position
 	for isDigit(l.char) {
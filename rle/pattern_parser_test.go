@@ -150,7 +150,10 @@ func TestParsePattern(t *testing.T) {
 	for _, test := range tests {
 		l := NewLexer(test.input)
 		pp := NewParser(l)
-		result := pp.ParsePattern(test.width, test.height)
+		result, err := pp.ParsePattern(test.width, test.height)
+		if err != nil {
+			t.Fatal(err)
+		}
 
 		if !reflect.DeepEqual(result, test.expected) {
 			t.Fatalf(
@@ -161,3 +164,78 @@ func TestParsePattern(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePatternErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"bo$2bo$3o!", ""},
+		{"bo$2bo$3o", ""},      // no end of pattern
+		{"bo$2b3o$3o!", ""},    // run exceeds the width
+		{"bo$2bo$3o$$o!", ""},  // rows exceed the height
+		{"b.AxpB$2bo$3o!", ""}, // letters of multi-state and other programs
+		{"bo$2bo$3o*!", "line 1, column 10: invalid character <*>"},
+		{"bo$\n2bo$\n 0o!", "line 3, column 2: invalid run count <0>"},
+		{"bo$2bo$yX!", "line 1, column 8: invalid cell state <yX>"},
+		{"99999999999999999999o!", "line 1, column 1: invalid run count <99999999999999999999>"},
+		{"4194304o!", "line 1, column 8: pattern exceeds 4194304 cells"},
+	}
+
+	for _, test := range tests {
+		_, err := NewParser(NewLexer(test.input)).ParsePattern(3, 3)
+
+		switch {
+		case test.expected == "" && err != nil:
+			t.Errorf("%s: unexpected error: %s", test.input, err)
+		case test.expected != "" && (err == nil || err.Error() != test.expected):
+			t.Errorf("%s: expected error <%s>, got <%v>", test.input, test.expected, err)
+		}
+	}
+
+	pattern, err := NewParser(NewLexer("bo$2b3o$3o$$o!")).ParsePattern(3, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]int{
+		{0, 1, 0, 0, 0},
+		{0, 0, 1, 1, 1},
+		{1, 1, 1, 0, 0},
+		{0, 0, 0, 0, 0},
+		{1, 0, 0, 0, 0},
+	}
+
+	if !reflect.DeepEqual(pattern, expected) {
+		t.Errorf("unexpected pattern: %v", pattern)
+	}
+}
+
+func FuzzParsePattern(f *testing.F) {
+	f.Add("bo$2bo$3o!", 3, 3)
+	f.Add(".AB$2.A$pA2.C!", 4, 3)
+	f.Add("3o5$12b2o!", 0, 0)
+
+	f.Fuzz(func(t *testing.T, input string, width, height int) {
+		pattern, err := NewParser(NewLexer(input)).ParsePattern(width, height)
+		if err != nil {
+			return
+		}
+
+		if len(pattern) < height {
+			t.Fatalf("pattern has %d rows, expected at least %d", len(pattern), height)
+		}
+
+		for _, row := range pattern {
+			if len(row) != len(pattern[0]) || len(row) < width {
+				t.Fatalf("row has %d cells, expected %d", len(row), len(pattern[0]))
+			}
+
+			for _, state := range row {
+				if state < 0 || state > MAX_STATE {
+					t.Fatalf("invalid state %d", state)
+				}
+			}
+		}
+	})
+}
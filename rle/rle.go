@@ -2,7 +2,9 @@
 package rle
 
 import (
+	"errors"
 	"fmt"
+	"image"
 	"os"
 	"regexp"
 	"strconv"
@@ -15,12 +17,21 @@ type RLE struct {
 	Height  int     // y
 	Pattern [][]int // The actual pattern
 
+	// metadata from the # lines before the header, see
+	// https://conwaylife.com/wiki/Run_Length_Encoded
+	Name       string      // #N
+	Author     string      // #O
+	Comments   []string    // #C and #c
+	Offset     image.Point // #P or #R, top left corner of the pattern
+	Positioned bool        // true if there was an offset
+
 	inputLines       []string
 	headerLineIndex  int
 	patternLineIndex int
 }
 
-// wrapper to load a RLE file
+// wrapper to load a RLE, plaintext or Life file, the format is detected
+// by the content
 func GetRLE(filename string) (*RLE, error) {
 	if filename == "" {
 		return nil, nil
@@ -31,6 +42,23 @@ func GetRLE(filename string) (*RLE, error) {
 		return nil, err
 	}
 
+	switch DetectFormat(string(content), filename) {
+	case FORMAT_CELLS:
+		parsedCells, err := ParseCells(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load plaintext pattern file: %s", err)
+		}
+
+		return &parsedCells, nil
+	case FORMAT_LIF:
+		parsedLife, err := ParseLife(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Life pattern file: %s", err)
+		}
+
+		return &parsedLife, nil
+	}
+
 	parsedRle, err := Parse(string(content))
 	if err != nil {
 		return nil, fmt.Errorf("failed to load RLE pattern file: %s", err)
@@ -44,9 +72,12 @@ func Parse(input string) (RLE, error) {
 		inputLines: strings.Split(input, "\n"),
 	}
 
-	rle.partitionFile()
+	err := rle.partitionFile()
+	if err != nil {
+		return RLE{}, err
+	}
 
-	err := rle.parseComments()
+	err = rle.parseComments()
 	if err != nil {
 		return RLE{}, err
 	}
@@ -75,41 +106,157 @@ func (rle *RLE) partitionFile() error {
 	return fmt.Errorf("invalid input: Header is missing")
 }
 
+// parse the # lines before the header. A rule given with #r is
+// overridden by the rule in the header.
 func (rle *RLE) parseComments() error {
+	for _, line := range rle.inputLines[:rle.headerLineIndex] {
+		line = strings.TrimSpace(line)
+
+		if len(line) < 2 || line[0] != '#' {
+			continue
+		}
+
+		value := strings.TrimSpace(line[2:])
+
+		switch line[1] {
+		case 'N':
+			rle.Name = value
+		case 'O':
+			rle.Author = value
+		case 'C', 'c':
+			rle.Comments = append(rle.Comments, value)
+		case 'r':
+			rle.Rule = value
+		case 'P', 'R':
+			var x, y int
+
+			if _, err := fmt.Sscanf(value, "%d %d", &x, &y); err != nil {
+				return fmt.Errorf("invalid offset <%s>", line)
+			}
+
+			rle.Offset = image.Pt(x, y)
+			rle.Positioned = true
+		}
+	}
+
 	return nil
 }
 
-func (rle *RLE) parseHeader() (err error) {
-	headerLine := removeWhitespace(rle.inputLines[rle.headerLineIndex])
+// the # lines describing the pattern, in the order LifeWiki uses
+func (rle *RLE) Header() string {
+	var header strings.Builder
 
-	headerElements := strings.SplitN(headerLine, ",", 3)
+	if rle.Name != "" {
+		fmt.Fprintf(&header, "#N %s\n", rle.Name)
+	}
 
-	rle.Width, err = strconv.Atoi(strings.TrimPrefix(headerElements[0], "x="))
-	if err != nil {
-		return err
+	if rle.Author != "" {
+		fmt.Fprintf(&header, "#O %s\n", rle.Author)
 	}
-	rle.Height, err = strconv.Atoi(strings.TrimPrefix(headerElements[1], "y="))
-	if err != nil {
-		return err
+
+	for _, comment := range rle.Comments {
+		fmt.Fprintf(&header, "#C %s\n", comment)
+	}
+
+	if rle.Positioned {
+		fmt.Fprintf(&header, "#P %d %d\n", rle.Offset.X, rle.Offset.Y)
+	}
+
+	return header.String()
+}
+
+// the grid position of the top left cell of the pattern. Positioned
+// patterns are put at their offset, on a bounded grid the offset counts
+// from the center of the grid, like in Golly. Other patterns and those
+// which wouldn't fit into the bounded grid at their offset are centered.
+func (rle *RLE) Origin(width, height int, bounded bool) image.Point {
+	center := image.Pt(width/2, height/2)
+
+	if rle.Positioned {
+		if !bounded {
+			return rle.Offset
+		}
+
+		origin := rle.Offset.Add(center)
+		area := image.Rect(0, 0, rle.Width, rle.Height).Add(origin)
+
+		if area.In(image.Rect(0, 0, width, height)) {
+			return origin
+		}
 	}
 
-	rle.Pattern = make([][]int, rle.Width)
+	return center.Sub(image.Pt(rle.Width/2, rle.Height/2))
+}
+
+// parse a header like "x = 3, y = 3, rule = B3/S23", the rule is
+// optional and may contain commas itself
+func (rle *RLE) parseHeader() error {
+	headerLine := removeWhitespace(rle.inputLines[rle.headerLineIndex])
+	line := rle.headerLineIndex + 1
+
+	size, rule, found := strings.Cut(headerLine, ",rule=")
+	if found {
+		rle.Rule = rule
+	}
+
+	gotx, goty := false, false
+
+	for _, element := range strings.Split(size, ",") {
+		key, value, _ := strings.Cut(element, "=")
+
+		var target *int
 
-	// check wehter a rule is present, since it's optional
-	if len(headerElements) == 3 {
-		rle.Rule = strings.TrimPrefix(headerElements[2], "rule=")
+		switch key {
+		case "x":
+			target, gotx = &rle.Width, true
+		case "y":
+			target, goty = &rle.Height, true
+		default:
+			// unknown entries are ignored
+			continue
+		}
+
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 0 {
+			return &ParseError{Line: line, Column: 1,
+				Message: fmt.Sprintf("invalid header <%s>", element)}
+		}
+
+		*target = number
+	}
+
+	if !gotx || !goty {
+		return &ParseError{Line: line, Column: 1,
+			Message: fmt.Sprintf("invalid header <%s>, expecting x and y", headerLine)}
 	}
 
 	return nil
 }
 
+// parse the pattern, its size is adjusted if it exceeds the header
 func (rle *RLE) parsePattern() error {
-	patternString := strings.Join(rle.inputLines[rle.patternLineIndex:], "")
+	patternString := strings.Join(rle.inputLines[rle.patternLineIndex:], "\n")
 
 	l := NewLexer(patternString)
 	pp := NewParser(l)
 
-	rle.Pattern = pp.ParsePattern(rle.Width, rle.Height)
+	pattern, err := pp.ParsePattern(rle.Width, rle.Height)
+	if err != nil {
+		var parseError *ParseError
+		if errors.As(err, &parseError) {
+			// the lexer counts from the first pattern line
+			parseError.Line += rle.patternLineIndex
+		}
+
+		return err
+	}
+
+	rle.Pattern = pattern
+	rle.Height = len(pattern)
+
+	if len(pattern) > 0 {
+		rle.Width = len(pattern[0])
+	}
 
 	return nil
 }
@@ -119,57 +266,53 @@ func removeWhitespace(input string) string {
 	return re.ReplaceAllString(input, "")
 }
 
-// Store a grid to an RLE file
-func StoreGridToRLE(grid [][]uint8, filename, rule string, width, height int) error {
+// Store a grid to an RLE file.  The # lines are taken from meta, which
+// may be nil, without a name the filename is used. Errors on closing the
+// file are returned as well, the file may be incomplete then.
+func StoreGridToRLE(grid Grid, filename, rule string, meta *RLE) (err error) {
 	fd, err := os.Create(filename)
 	if err != nil {
 		return err
 	}
 
-	var pattern string
-
-	for y := 0; y < height; y++ {
-		line := ""
-		for x := 0; x < width; x++ {
-			char := "b"
-			if grid[y][x] == 1 {
-				char = "o"
-			}
-
-			line += char
+	defer func() {
+		if cerr := fd.Close(); err == nil {
+			err = cerr
 		}
+	}()
 
-		// if first row is: 001011110, then line is now:
-		//                  bboboooob
-
-		encoded := RunLengthEncode(line)
+	header := RLE{Name: filename}
+	if meta != nil {
+		header = *meta
 
-		// and now its:     2bob4ob
-		pattern += encoded
-
-		if y != height-1 {
-			pattern += "$"
+		if header.Name == "" {
+			header.Name = filename
 		}
 	}
 
-	pattern += "!"
+	return NewEncoder(fd).Encode(grid, rule, &header)
+}
+
+// run length encode a row of cells. Multi-state cells can be written
+// using two letters, so we count runs of cells, not of characters.
+func EncodeRow(row []uint8, multistate bool) string {
+	encoded := ""
 
-	wrapped := ""
-	for idx, char := range pattern {
-		if idx%70 == 0 && idx != 0 {
-			wrapped += "\n"
+	for start := 0; start < len(row); {
+		end := start + 1
+		for end < len(row) && row[end] == row[start] {
+			end++
 		}
-		wrapped += string(char)
-	}
 
-	_, err = fmt.Fprintf(fd, "#N %s\nx = %d, y = %d, rule = %s\n%s\n",
-		filename, width, height, rule, wrapped)
+		if end-start > 1 {
+			encoded += strconv.Itoa(end - start)
+		}
 
-	if err != nil {
-		return err
+		encoded += StateLetters(int(row[start]), multistate)
+		start = end
 	}
 
-	return nil
+	return encoded
 }
 
 // by peterSO on
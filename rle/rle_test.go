@@ -1,7 +1,11 @@
 package rle
 
 import (
+	"fmt"
+	"image"
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -50,6 +54,18 @@ func TestRLE(t *testing.T) {
 				expectedHeight: 9,
 				expectedRule:   "B3/S23",
 			},
+			{
+				input: `x = 3, y = 3, rule = B3/S23:K20*,10
+				bo$2bo$3o!`,
+				expectedPattern: [][]int{
+					{0, 1, 0},
+					{0, 0, 1},
+					{1, 1, 1},
+				},
+				expectedWidth:  3,
+				expectedHeight: 3,
+				expectedRule:   "B3/S23:K20*,10",
+			},
 		}
 
 		for _, test := range tests {
@@ -82,3 +98,179 @@ func TestRLE(t *testing.T) {
 	})
 
 }
+
+func TestMultiState(t *testing.T) {
+	input := `x = 4, y = 3, rule = B2/S/C3
+.AB$2.A$pA2.C!`
+
+	rle, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := [][]int{
+		{0, 1, 2, 0},
+		{0, 0, 1, 0},
+		{25, 0, 0, 3},
+	}
+
+	if !reflect.DeepEqual(rle.Pattern, expected) {
+		t.Errorf("unexpected pattern: %v", rle.Pattern)
+	}
+
+	for state := 0; state < 256; state++ {
+		tok := NewLexer(StateLetters(state, true)).NextToken()
+
+		if CellState(tok) != state {
+			t.Errorf("state %d encoded as %s, decoded as %d",
+				state, StateLetters(state, true), CellState(tok))
+		}
+	}
+
+	if encoded := EncodeRow([]uint8{0, 0, 2, 2, 2, 1, 30}, true); encoded != "2.3BApF" {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+
+	if encoded := EncodeRow([]uint8{0, 0, 1, 1, 1, 0}, false); encoded != "2b3ob" {
+		t.Errorf("unexpected encoding: %s", encoded)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	input := `#N Glider
+#O Richard K. Guy
+#C The smallest, most common, and first discovered spaceship.
+#C www.conwaylife.com/wiki/index.php?title=Glider
+#P -1 2
+#r 23/3
+x = 3, y = 3
+bo$2bo$3o!`
+
+	pattern, err := Parse(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := RLE{
+		Name:   "Glider",
+		Author: "Richard K. Guy",
+		Comments: []string{
+			"The smallest, most common, and first discovered spaceship.",
+			"www.conwaylife.com/wiki/index.php?title=Glider",
+		},
+		Offset:     image.Pt(-1, 2),
+		Positioned: true,
+	}
+
+	if pattern.Name != expected.Name || pattern.Author != expected.Author ||
+		!reflect.DeepEqual(pattern.Comments, expected.Comments) ||
+		pattern.Offset != expected.Offset || !pattern.Positioned {
+		t.Errorf("unexpected metadata: %+v", pattern)
+	}
+
+	if pattern.Rule != "23/3" {
+		t.Errorf("rule from #r not used: %s", pattern.Rule)
+	}
+
+	if _, err := Parse("#P 1\nx = 1, y = 1\no!"); err == nil {
+		t.Errorf("invalid offset accepted")
+	}
+
+	// round trip
+	filename := filepath.Join(t.TempDir(), "glider.rle")
+	grid := [][]uint8{{0, 1, 0}, {0, 0, 1}, {1, 1, 1}}
+
+	if err := StoreGridToRLE(Cells(grid), filename, "B3/S23", &pattern); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := GetRLE(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stored.Name != expected.Name || stored.Author != expected.Author ||
+		!reflect.DeepEqual(stored.Comments, expected.Comments) ||
+		stored.Offset != expected.Offset || !stored.Positioned {
+		t.Errorf("metadata lost: %+v", stored)
+	}
+
+	if stored.Rule != "B3/S23" {
+		t.Errorf("unexpected rule: %s", stored.Rule)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"bo$2bo$3o!", "invalid input: Header is missing"},
+		{"#N test\nx = 3\nbo$2bo$3o!", "line 2, column 1: invalid header <x=3>, expecting x and y"},
+		{"x = 3, y = -1\nbo$2bo$3o!", "line 1, column 1: invalid header <y=-1>"},
+		{"#C test\nx = 3, y = 3\nbo$\n2bo$3o#!", "line 4, column 7: invalid character <#>"},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.input)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("expected error <%s>, got <%v>", test.expected, err)
+		}
+	}
+
+	// the size is adjusted to the pattern
+	pattern, err := Parse("x = 2, y = 1, rule = R2,C0,M1,S2..3,B3..3,NM\nbo$2bo$3o!")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pattern.Width != 3 || pattern.Height != 3 || pattern.Rule != "R2,C0,M1,S2..3,B3..3,NM" {
+		t.Errorf("unexpected pattern: %+v", pattern)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add("#N Glider\n#P 1 2\nx = 3, y = 3, rule = B3/S23\nbo$2bo$3o!")
+	f.Add("x = 4, y = 3, rule = B2/S/C3\n.AB$2.A$pA2.C!")
+	f.Add("x=0,y=0\n!")
+
+	f.Fuzz(func(t *testing.T, input string) {
+		pattern, err := Parse(input)
+		if err != nil {
+			return
+		}
+
+		if len(pattern.Pattern) != pattern.Height {
+			t.Fatalf("pattern has %d rows, header says %d", len(pattern.Pattern), pattern.Height)
+		}
+
+		// encode it again, it has to result in the same pattern
+		var encoded strings.Builder
+
+		for y, row := range pattern.Pattern {
+			if len(row) != pattern.Width {
+				t.Fatalf("row has %d cells, header says %d", len(row), pattern.Width)
+			}
+
+			cells := make([]uint8, len(row))
+			for x, state := range row {
+				cells[x] = uint8(state)
+			}
+
+			if y > 0 {
+				encoded.WriteString("$")
+			}
+
+			encoded.WriteString(EncodeRow(cells, true))
+		}
+
+		again, err := Parse(fmt.Sprintf("x = %d, y = %d\n%s!", pattern.Width, pattern.Height, encoded.String()))
+		if err != nil {
+			t.Fatalf("failed to parse encoded pattern: %s", err)
+		}
+
+		if !reflect.DeepEqual(again.Pattern, pattern.Pattern) {
+			t.Fatalf("encoded pattern differs: %v != %v", again.Pattern, pattern.Pattern)
+		}
+	})
+}
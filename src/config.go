@@ -3,13 +3,17 @@ package main
 import (
 	"errors"
 	"fmt"
+	"image"
 	"math"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/spf13/pflag"
+	"github.com/tlinden/golsky/engine"
 	"github.com/tlinden/golsky/rle"
 )
 
@@ -17,17 +21,20 @@ import (
 type Config struct {
 	Width, Height, Cellsize, Density         int // measurements
 	ScreenWidth, ScreenHeight                int
-	TPG                                      int      // ticks per generation/game speed, 1==max
-	Debug, Empty, Paused, Markmode, Drawmode bool     // game modi
-	ShowEvolution, ShowGrid, RunOneStep      bool     // flags
-	Rule                                     *Rule    // which rule to use, default: B3/S23
-	RLE                                      *rle.RLE // loaded GOL pattern from RLE file
-	Statefile                                string   // load game state from it if non-nil
-	StateGrid                                *Grid    // a grid from a statefile
-	Wrap                                     bool     // wether wraparound mode is in place or not
+	TPG                                      int          // ticks per generation/game speed, 1==max
+	Debug, Empty, Paused, Markmode, Drawmode bool         // game modi
+	ShowEvolution, ShowGrid, RunOneStep      bool         // flags
+	ShowInfo                                 bool         // show the metadata of the loaded pattern
+	Rule                                     *engine.Rule // which rule to use, default: B3/S23
+	RLE                                      *rle.RLE     // loaded GOL pattern from RLE file
+	Statefile                                string       // load game state from it if non-nil
+	Wrap                                     bool         // wether wraparound mode is in place or not
 	ShowVersion                              bool
 	UseShader                                bool // to use a shader to render alife cells
 	Restart, RestartGrid, RestartCache       bool
+	RestartRule                              bool            // the rule has been changed at runtime
+	RestartSize                              bool            // the grid size has been changed at runtime
+	ResizeFrom                               image.Rectangle // the previous grid inside the resized one
 	StartWithMenu                            bool
 	Zoomfactor                               int
 	ZoomOutFactor                            int
@@ -35,6 +42,20 @@ type Config struct {
 	DelayedStart                             bool // if true game, we wait. like pause but program induced
 	Theme                                    string
 	ThemeManager                             ThemeManager
+	Engine                                   string // simulation engine, see engine.ENGINES
+	HashLife                                 bool   // use the HashLife engine
+	HashLifeStep                             int    // HashLife: advance 2^n generations per step
+	Unbounded                                bool   // infinite plane, grid size is only the initial area
+	Headless                                 bool   // run without window, see RunHeadless()
+	Generations                              int64  // headless: number of generations to compute
+	Outfile                                  string // headless: save the final state to it
+	HexOffset                                bool   // draw hexagonal rules as hex grid
+	InitialRow                               string // one-dimensional rules: random or single
+	HistoryLimit                             int    // number of frames kept for undo and rewind
+	RecordSteps                              bool   // record every generation, not only edits and single steps
+	MarkFormat                               string // format of saved rectangles, rle or cells
+	StateFormat                              string // format of state files, Life 1.05 or 1.06
+	Seed                                     int64  // seed of the random soup
 
 	// for internal profiling
 	ProfileFile     string
@@ -44,8 +65,6 @@ type Config struct {
 
 const (
 	VERSION = "v0.0.9"
-	Alive   = 1
-	Dead    = 0
 
 	DEFAULT_GRID_WIDTH  = 600
 	DEFAULT_GRID_HEIGHT = 400
@@ -53,6 +72,12 @@ const (
 	DEFAULT_ZOOMFACTOR  = 400
 	DEFAULT_GEOM        = "640x384"
 	DEFAULT_THEME       = "standard"
+	DEFAULT_ENGINE      = engine.GRID
+
+	ROW_RANDOM = "random"
+	ROW_SINGLE = "single"
+
+	SEED_COMMENT = "seed "
 )
 
 const KEYBINDINGS string = `
@@ -70,7 +95,12 @@ const KEYBINDINGS string = `
 - S: save game state to file (can be loaded with -l)
 - C: enter mark mode. Mark a rectangle with the mouse, when you
      release the mouse buttonx it is being saved to an RLE file
+- SHIFT-C: like C, but save the rectangle as plaintext .cells file
 - D: toggle debug output 
+- P: toggle pattern info: name, author and comments of the loaded pattern
+- CTRL-Z: undo, CTRL-Y or CTRL-SHIFT-Z: redo, works for edits and generations
+- B: step back one generation
+- , and .: hold to rewind or fast forward through the history
 - Q: quit game
 `
 
@@ -134,29 +164,16 @@ func (config *Config) ParseGeom(geom string) error {
 	return nil
 }
 
-// check if we have  been given an RLE or LIF file  to load, then load
+// check if we have been given an RLE, plaintext or LIF file to load, then load
 // it and adjust game settings accordingly
 func (config *Config) ParseRLE(rlefile string) error {
 	if rlefile == "" {
 		return nil
 	}
 
-	var rleobj *rle.RLE
-
-	if strings.HasSuffix(rlefile, ".lif") {
-		lifobj, err := LoadLIF(rlefile)
-		if err != nil {
-			return err
-		}
-
-		rleobj = lifobj
-	} else {
-		rleobject, err := rle.GetRLE(rlefile)
-		if err != nil {
-			return err
-		}
-
-		rleobj = rleobject
+	rleobj, err := rle.GetRLE(rlefile)
+	if err != nil {
+		return err
 	}
 
 	if rleobj == nil {
@@ -165,6 +182,11 @@ func (config *Config) ParseRLE(rlefile string) error {
 
 	config.RLE = rleobj
 
+	// state files know the soup they came from
+	if seed, ok := PatternSeed(rleobj); ok {
+		config.Seed = seed
+	}
+
 	// adjust geometry if needed
 	if config.RLE.Width > config.Width || config.RLE.Height > config.Height {
 		config.Width = config.RLE.Width * 2
@@ -172,15 +194,129 @@ func (config *Config) ParseRLE(rlefile string) error {
 		config.Cellsize = config.ScreenWidth / config.Width
 	}
 
-	fmt.Printf("width: %d, screenwidth: %d, rlewidth: %d, cellsize: %d\n",
-		config.Width, config.ScreenWidth, config.RLE.Width, config.Cellsize)
+	if !config.Headless {
+		fmt.Printf("width: %d, screenwidth: %d, rlewidth: %d, cellsize: %d\n",
+			config.Width, config.ScreenWidth, config.RLE.Width, config.Cellsize)
+	}
 
 	// RLE needs an empty grid
 	config.Empty = true
 
-	// it may come with its own rule
+	// it may come with its own rule, which may be a rule file next to
+	// the pattern file
 	if config.RLE.Rule != "" {
-		config.Rule = ParseGameRule(config.RLE.Rule)
+		rule, err := engine.LoadRule(config.RLE.Rule, filepath.Dir(rlefile))
+		if err != nil {
+			return err
+		}
+
+		config.Rule = rule
+	}
+
+	return nil
+}
+
+// A  rule like B3/S23:K100*,80  defines the grid size and  how its
+// edges are joined, everything but a plane wraps around
+func (config *Config) ApplyTopology() {
+	topology := config.Rule.Topology
+
+	if topology.Kind == 0 {
+		return
+	}
+
+	if topology.Width > 0 {
+		config.Width = topology.Width
+		config.Height = topology.Height
+	}
+
+	config.Wrap = topology.Kind != engine.PLANE_TOPOLOGY
+}
+
+// check if the selected engine can be used with the other settings. The
+// HashLife engine is selected automatically if a step size has been given
+func (config *Config) CheckEngine() error {
+	if config.HashLife || config.HashLifeStep > 0 {
+		config.Engine = engine.HASHLIFE
+	}
+
+	// one-dimensional rules have their own engine
+	if config.Rule.Elementary {
+		config.Engine = engine.ELEMENTARY
+	}
+
+	if config.InitialRow != ROW_RANDOM && config.InitialRow != ROW_SINGLE {
+		return errors.New("the initial row must be either random or single")
+	}
+
+	if config.Engine == engine.BITGRID && config.Unbounded {
+		return errors.New("the bitgrid engine can not be used on an unbounded plane")
+	}
+
+	if config.HashLifeStep < 0 || config.HashLifeStep > 60 {
+		return errors.New("HashLife step must be between 0 and 60")
+	}
+
+	return engine.Check(config.EngineName(), config.EngineOptions())
+}
+
+// return the  name of the engine  to use, the flat  grid is replaced by
+// the sparse plane in unbounded mode
+func (config *Config) EngineName() string {
+	if config.Unbounded && config.Engine == engine.GRID {
+		return engine.PLANE
+	}
+
+	return config.Engine
+}
+
+func (config *Config) EngineOptions() engine.Options {
+	return engine.Options{
+		Width:    config.Width,
+		Height:   config.Height,
+		Wrap:     config.Wrap,
+		Rule:     config.Rule,
+		Topology: config.Rule.Topology,
+	}
+}
+
+// generations computed per step, HashLife can advance in large leaps
+func (config *Config) StepSize() int64 {
+	if config.EngineName() == engine.HASHLIFE {
+		return 1 << config.HashLifeStep
+	}
+
+	return 1
+}
+
+// check if the unbounded plane can be used with the other settings
+func (config *Config) CheckUnbounded() error {
+	if !config.Unbounded {
+		return nil
+	}
+
+	switch {
+	case config.Wrap:
+		return errors.New("wrap around mode can not be used on an unbounded plane")
+	case config.Rule.Topology.Kind != 0:
+		return errors.New("bounded grid rules can not be used on an unbounded plane")
+	case config.Rule.Elementary:
+		return errors.New("one-dimensional rules can not be used on an unbounded plane")
+	case config.Rule.HasB0() && !config.Rule.Strobes():
+		return errors.New("B0 Generations or Larger than Life rules can not be used on an unbounded plane")
+	}
+
+	return nil
+}
+
+// check the headless mode settings
+func (config *Config) CheckHeadless() error {
+	switch {
+	case config.Generations < 0:
+		return errors.New("the number of generations must not be negative")
+	case config.Outfile != "" && !strings.HasSuffix(config.Outfile, ".rle") &&
+		!strings.HasSuffix(config.Outfile, ".cells") && !strings.HasSuffix(config.Outfile, ".lif"):
+		return errors.New("the output file must end in .rle, .cells or .lif")
 	}
 
 	return nil
@@ -219,8 +355,13 @@ func ParseCommandline() (*Config, error) {
 	pflag.IntVarP(&config.TPG, "ticks-per-generation", "t", 10,
 		"game speed: the higher the slower (default: 10)")
 
-	pflag.StringVarP(&rule, "rule", "r", "B3/S23", "game rule")
-	pflag.StringVarP(&rlefile, "pattern-file", "f", "", "RLE or LIF pattern file")
+	pflag.StringVarP(&rule, "rule", "r", "B3/S23",
+		"game rule, rule name like HighLife, elementary rule like W110 or Golly rule file, may end with a bounded grid like :T100,80")
+	pflag.StringVarP(&rlefile, "pattern-file", "f", "", "RLE, plaintext (.cells) or LIF pattern file")
+	pflag.StringVarP(&config.StateFormat, "state-format", "", rle.LIFE_105,
+		"format of saved state files: 1.05 keeps the whole grid, 1.06 only lists life cells (compact for sparse grids)")
+	pflag.StringVarP(&config.InitialRow, "initial-row", "", ROW_RANDOM,
+		"one-dimensional rules like W110: start with a random row or a single cell (random or single)")
 
 	pflag.BoolVarP(&config.ShowVersion, "version", "v", false, "show version")
 	pflag.BoolVarP(&config.ShowGrid, "show-grid", "g", false, "draw grid lines")
@@ -234,12 +375,41 @@ func ParseCommandline() (*Config, error) {
 	pflag.StringVarP(&config.Theme, "theme", "T", DEFAULT_THEME, "color theme: standard, dark, light (default: standard)")
 
 	pflag.BoolVarP(&config.Wrap, "wrap-around", "w", false, "wrap around grid mode")
+	pflag.BoolVarP(&config.HexOffset, "hex-offset", "", false, "draw hexagonal rules (like B2/S34H) as hex grid")
 	pflag.BoolVarP(&config.UseShader, "use-shader", "k", false, "use shader for cell rendering")
 
+	pflag.BoolVarP(&config.Unbounded, "unbounded", "u", false, "unbounded plane, the grid is only the initial area")
+	pflag.StringVarP(&config.Engine, "engine", "E", DEFAULT_ENGINE,
+		"simulation engine: "+strings.Join(engine.ENGINES, ", "))
+	pflag.BoolVarP(&config.HashLife, "hashlife", "", false, "use the HashLife engine")
+	pflag.IntVarP(&config.HashLifeStep, "hashlife-step", "", 0,
+		"HashLife: advance 2^n generations per step, implies --hashlife")
+
+	pflag.Int64VarP(&config.Seed, "seed", "", 0,
+		"seed of the random soup, the same seed, size, density and rule give the same soup (default: random)")
+	pflag.IntVarP(&config.HistoryLimit, "history-limit", "", DEFAULT_HISTORY_LIMIT,
+		"number of generations and edits kept for undo and rewind, 0 disables it")
+	pflag.BoolVarP(&config.RecordSteps, "record-steps", "", false,
+		"record every generation for rewinding, not only edits and single steps (slow on large grids)")
+
+	pflag.BoolVarP(&config.Headless, "headless", "", false, "run without window, print statistics and exit")
+	pflag.Int64VarP(&config.Generations, "generations", "", 1000, "headless: number of generations to compute")
+	pflag.StringVarP(&config.Outfile, "out", "", "", "headless: save final state to file (*.rle, *.cells or *.lif)")
+
 	pflag.StringVarP(&config.ProfileFile, "profile-file", "", "", "enable profiling")
 
 	pflag.Parse()
 
+	if !pflag.CommandLine.Changed("seed") {
+		config.NewSeed()
+	}
+
+	config.MarkFormat = rle.FORMAT_RLE
+
+	if config.StateFormat != rle.LIFE_105 && config.StateFormat != rle.LIFE_106 {
+		return nil, errors.New("the state format must be either 1.05 or 1.06")
+	}
+
 	err := config.ParseGeom(geom)
 	if err != nil {
 		return nil, err
@@ -251,9 +421,30 @@ func ParseCommandline() (*Config, error) {
 	}
 
 	// load  rule from commandline  when no  rule came from  RLE file,
-	// default is B3/S23, aka conways game of life
+	// default is B3/S23, aka conways game of life. It may also be a
+	// Golly rule file.
 	if config.Rule == nil {
-		config.Rule = ParseGameRule(rule)
+		config.Rule, err = engine.LoadRule(rule, ".")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	config.ApplyTopology()
+
+	err = config.CheckEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.CheckUnbounded()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.Headless {
+		// no window, no camera and no theme needed
+		return &config, config.CheckHeadless()
 	}
 
 	config.SetupCamera()
@@ -264,6 +455,11 @@ func ParseCommandline() (*Config, error) {
 	return &config, nil
 }
 
+// pick a new seed for the next random soup
+func (config *Config) NewSeed() {
+	config.Seed = time.Now().UnixNano()
+}
+
 func (config *Config) TogglePaused() {
 	config.Paused = !config.Paused
 }
@@ -286,6 +482,117 @@ func (config *Config) ToggleEvolution() {
 	config.ShowEvolution = !config.ShowEvolution
 }
 
-func (config *Config) ToggleWrap() {
-	config.Wrap = !config.Wrap
+// switch wrap around mode for the next restart, the engine in use has
+// to support it
+func (config *Config) SetWrap(wrap bool) error {
+	options := config.EngineOptions()
+	options.Wrap = wrap
+
+	if err := engine.Check(config.EngineName(), options); err != nil {
+		return err
+	}
+
+	config.Wrap = wrap
+
+	return nil
+}
+
+func (config *Config) ToggleHexOffset() {
+	config.HexOffset = !config.HexOffset
+	config.RestartCache = true
+}
+
+// parse a rule and check wether it can replace the current one at
+// runtime: the engine in use has to support it and the bounded grid
+// can't be changed. The topology of the current rule is kept, if the
+// new one has none. Names of registered rules and rule files can be
+// used as well.
+func (config *Config) CheckRule(definition string) (*engine.Rule, error) {
+	definition = strings.TrimSpace(definition)
+
+	_, suffix, found := strings.Cut(config.Rule.Definition, ":")
+	if found && !strings.Contains(definition, ":") {
+		definition += ":" + suffix
+	}
+
+	rule, err := engine.LoadRule(definition, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	if rule.Topology != config.Rule.Topology {
+		return nil, errors.New("the bounded grid can not be changed at runtime")
+	}
+
+	options := config.EngineOptions()
+	options.Rule = rule
+
+	if err = engine.Check(config.EngineName(), options); err != nil {
+		return nil, err
+	}
+
+	if config.Unbounded && rule.HasB0() && !rule.Strobes() {
+		return nil, errors.New("this B0 rule can not be used on an unbounded plane")
+	}
+
+	return rule, nil
+}
+
+// switch to another rule at runtime, see CheckRule()
+func (config *Config) SwitchRule(definition string) error {
+	rule, err := config.CheckRule(definition)
+	if err != nil {
+		return err
+	}
+
+	// the hex grid is wider than the square one
+	if config.HexOffset && (rule.Neighborhood == engine.HEXAGONAL) != (config.Rule.Neighborhood == engine.HEXAGONAL) {
+		config.RestartCache = true
+	}
+
+	config.Rule = rule
+	config.RestartRule = true
+
+	return nil
+}
+
+// change the size of the grid and the cells at runtime, the pattern is
+// kept either centered or anchored at the top left corner. The density
+// is used for the next random start.
+func (config *Config) Resize(width, height, cellsize, density int, centered bool) error {
+	switch {
+	case width < 1 || height < 1:
+		return errors.New("width and height must be positive")
+	case cellsize < 1 || cellsize > 64:
+		return errors.New("the cell size must be between 1 and 64")
+	case density < 2:
+		return errors.New("the density must be at least 2")
+	case config.Rule.Topology.Width > 0 && (width != config.Width || height != config.Height):
+		return errors.New("the grid size is defined by the rule")
+	}
+
+	options := config.EngineOptions()
+	options.Width = width
+	options.Height = height
+
+	if err := engine.Check(config.EngineName(), options); err != nil {
+		return err
+	}
+
+	offset := image.Point{}
+	if centered {
+		offset = image.Pt((width-config.Width)/2, (height-config.Height)/2)
+	}
+
+	config.ResizeFrom = image.Rect(0, 0, config.Width, config.Height).Add(offset)
+
+	config.Width = width
+	config.Height = height
+	config.Cellsize = cellsize
+	config.Density = density
+	config.RestartSize = true
+
+	config.SetupCamera()
+
+	return nil
 }
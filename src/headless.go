@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"strings"
+	"time"
+
+	"github.com/tlinden/golsky/engine"
+)
+
+// Run the simulation without  a window, to be used in  scripts and CI.
+// The  universe is set  up the  same way as  in the  game, then the
+// configured number of generations is computed at once. Statistics are
+// printed to stdout, the final state is saved to the output file if any.
+func RunHeadless(config *Config) error {
+	universe, err := engine.New(config.EngineName(), config.EngineOptions())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case config.Rule.Elementary:
+		if !config.Empty {
+			SeedRow(universe, config.InitialRow, config.Width, config.Density, config.Seed)
+		}
+
+		LoadRow(universe, config.RLE, config.Width)
+	default:
+		if !config.Empty {
+			FillRandom(universe, config.Width, config.Height, config.Density, config.Seed)
+		}
+
+		LoadRLE(universe, config.RLE, config.Width, config.Height, !config.Unbounded)
+	}
+
+	population := universe.Population()
+	start := time.Now()
+
+	universe.Step(config.Generations)
+
+	elapsed := time.Since(start)
+
+	fmt.Printf("engine:      %s\n", config.EngineName())
+	fmt.Printf("rule:        %s\n", config.Rule.Definition)
+	fmt.Printf("seed:        %d\n", config.Seed)
+	fmt.Printf("generations: %d\n", universe.Generation())
+	fmt.Printf("population:  %d (initial: %d)\n", universe.Population(), population)
+	fmt.Printf("bounds:      %s\n", universe.Bounds())
+	fmt.Printf("elapsed:     %s\n", elapsed)
+
+	if inverter, ok := universe.(engine.Inverter); ok && inverter.Inverted() {
+		// B0 rule, population and bounds are those of the dead cells
+		fmt.Println("background:  alive, cells are inverted")
+	}
+
+	if elapsed > 0 {
+		fmt.Printf("speed:       %.02f generations/s\n",
+			float64(universe.Generation())/elapsed.Seconds())
+	}
+
+	if config.Outfile == "" {
+		return nil
+	}
+
+	// RLE files only contain the pattern, state files the whole grid
+	// just like in the game
+	bounds := universe.Bounds()
+	if inverter, ok := universe.(engine.Inverter); ok && inverter.Inverted() {
+		// the bounds are those of the dead cells, the life ones fill
+		// the grid
+		bounds = image.Rect(0, 0, config.Width, config.Height)
+	}
+
+	// state files of Generations rules become RLE files
+	outfile := config.Outfile
+
+	switch {
+	case strings.HasSuffix(config.Outfile, ".rle"):
+		err = SaveRLE(config.Outfile, config.Rule.Definition, config.RLE, bounds, universe)
+	case strings.HasSuffix(config.Outfile, ".cells"):
+		err = SaveCells(config.Outfile, config.RLE, bounds, universe)
+	default:
+		rect := image.Rect(0, 0, config.Width, config.Height)
+		origin := image.Pt(config.Width/2, config.Height/2)
+		if config.Unbounded {
+			rect, origin = universe.Bounds(), image.Point{}
+		}
+
+		outfile, err = SaveState(config.Outfile, config.Rule.Definition, config.StateFormat, config.Seed, rect,
+			origin, universe)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to save final state to %s: %w", outfile, err)
+	}
+
+	fmt.Printf("saved final state to %s\n", outfile)
+
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"image"
+	"maps"
+
+	"github.com/tlinden/golsky/engine"
+)
+
+// Undo, redo and rewind.
+//
+// The history is a list of frames, each one holds the state of the
+// universe after a generation or an edit. Frames only store the cells
+// which changed since the previous frame, every HISTORY_KEYFRAMES frames
+// a keyframe holds all non-dead cells. To go back to a frame the cells
+// are taken from the keyframe before it, then the changes of the frames
+// up to it are applied.
+//
+// Recording a new frame after going back drops the frames after the
+// current one, just like undo in an editor. If there are more frames
+// than the limit, the oldest ones are dropped and their changes are
+// folded into the first frame kept, which becomes a keyframe.
+
+const (
+	HISTORY_KEYFRAMES     = 50   // a keyframe every n frames
+	HISTORY_INTERVAL      = 25   // running generations: a frame every n generations
+	DEFAULT_HISTORY_LIMIT = 1000 // number of frames kept
+)
+
+// what lead to a frame
+const (
+	FRAME_START = iota
+	FRAME_STEP
+	FRAME_EDIT
+)
+
+type Frame struct {
+	Kind       int
+	Generation int64
+	Inverted   bool                  // B0 rules: the cells are stored inverted
+	Keyframe   map[image.Point]uint8 // all non-dead cells, nil if not a keyframe
+	Changes    map[image.Point]uint8 // cells changed since the previous frame
+}
+
+type History struct {
+	Frames []Frame
+	Index  int // the current frame, the ones after it can be redone
+	Limit  int // maximum number of frames, 0 disables the history
+
+	cells     map[image.Point]uint8 // the cells of the current frame
+	keyframed int                   // frames since the last keyframe
+}
+
+func NewHistory(limit int) *History {
+	return &History{Limit: limit}
+}
+
+// record the cells of the universe inside area as a new frame
+func (history *History) Record(universe engine.Universe, area image.Rectangle, kind int, generation int64) {
+	if history.Limit <= 0 {
+		return
+	}
+
+	cells := map[image.Point]uint8{}
+
+	universe.Each(area, func(x, y int) {
+		cells[image.Pt(x, y)] = universe.Get(x, y)
+	})
+
+	frame := Frame{Kind: kind, Generation: generation}
+
+	if inverter, ok := universe.(engine.Inverter); ok {
+		frame.Inverted = inverter.Inverted()
+	}
+
+	// drop the frames which have been undone
+	if len(history.Frames) > 0 {
+		history.Frames = history.Frames[:history.Index+1]
+		history.keyframed = history.Index - history.LastKeyframe(history.Index)
+	}
+
+	if len(history.Frames) == 0 || history.keyframed+1 >= HISTORY_KEYFRAMES {
+		frame.Keyframe = cells
+		history.keyframed = 0
+	} else {
+		frame.Changes = Changes(history.cells, cells)
+		history.keyframed++
+	}
+
+	history.Frames = append(history.Frames, frame)
+	history.Index = len(history.Frames) - 1
+	history.cells = cells
+
+	history.Trim()
+}
+
+// drop the oldest frames if there are too many, the first frame has to
+// stay a keyframe
+func (history *History) Trim() {
+	for len(history.Frames) > history.Limit {
+		first, next := history.Frames[0], &history.Frames[1]
+
+		if next.Keyframe == nil {
+			// the keyframe is dropped, so its map can be reused
+			cells := first.Keyframe
+
+			for point, state := range next.Changes {
+				if state == engine.Dead {
+					delete(cells, point)
+				} else {
+					cells[point] = state
+				}
+			}
+
+			next.Keyframe, next.Changes = cells, nil
+		}
+
+		history.Frames = history.Frames[1:]
+		history.Index--
+	}
+
+	history.keyframed = history.Index - history.LastKeyframe(history.Index)
+}
+
+// the cells which differ between two frames, removed cells are dead
+func Changes(previous, current map[image.Point]uint8) map[image.Point]uint8 {
+	changes := map[image.Point]uint8{}
+
+	for point, state := range current {
+		if previous[point] != state {
+			changes[point] = state
+		}
+	}
+
+	for point := range previous {
+		if _, ok := current[point]; !ok {
+			changes[point] = engine.Dead
+		}
+	}
+
+	return changes
+}
+
+// index of the last keyframe up to the given frame
+func (history *History) LastKeyframe(index int) int {
+	for history.Frames[index].Keyframe == nil {
+		index--
+	}
+
+	return index
+}
+
+// compute the cells of the given frame
+func (history *History) Cells(index int) map[image.Point]uint8 {
+	start := history.LastKeyframe(index)
+	cells := maps.Clone(history.Frames[start].Keyframe)
+
+	for _, frame := range history.Frames[start+1 : index+1] {
+		for point, state := range frame.Changes {
+			if state == engine.Dead {
+				delete(cells, point)
+			} else {
+				cells[point] = state
+			}
+		}
+	}
+
+	return cells
+}
+
+// the generation of the current frame, false if nothing is recorded
+func (history *History) Generation() (int64, bool) {
+	if len(history.Frames) == 0 {
+		return 0, false
+	}
+
+	return history.Frames[history.Index].Generation, true
+}
+
+// true if index is another recorded frame than the current one
+func (history *History) CanSeek(index int) bool {
+	return index >= 0 && index < len(history.Frames) && index != history.Index
+}
+
+// make the given frame the current one, returns false if there is no
+// such frame
+func (history *History) Seek(index int) (*Frame, map[image.Point]uint8, bool) {
+	if !history.CanSeek(index) {
+		return nil, nil, false
+	}
+
+	history.Index = index
+	history.cells = history.Cells(index)
+
+	return &history.Frames[index], history.cells, true
+}
+
+// index of the latest frame showing an earlier generation than the
+// current one, -1 if there is none
+func (history *History) PreviousGeneration() int {
+	if len(history.Frames) == 0 {
+		return -1
+	}
+
+	current := history.Frames[history.Index].Generation
+
+	for idx := history.Index - 1; idx >= 0; idx-- {
+		if history.Frames[idx].Generation < current {
+			return idx
+		}
+	}
+
+	return -1
+}
@@ -28,13 +28,6 @@ func main() {
 		os.Exit(0)
 	}
 
-	start := Play
-	if !directstart {
-		start = Menu
-		config.DelayedStart = true
-	}
-	game := NewGame(config, SceneName(start))
-
 	if config.ProfileFile != "" {
 		// enable  cpu profiling. Do  NOT use q  to stop the  game but
 		// close the window to get a profile
@@ -48,6 +41,21 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	if config.Headless {
+		if err := RunHeadless(config); err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	start := Play
+	if !directstart {
+		start = Menu
+		config.DelayedStart = true
+	}
+	game := NewGame(config, SceneName(start))
+
 	// main loop
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
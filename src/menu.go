@@ -7,6 +7,7 @@ import (
 	"github.com/ebitenui/ebitenui/widget"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/tlinden/golsky/rle"
 )
 
 type SceneMenu struct {
@@ -90,6 +91,14 @@ func (scene *SceneMenu) Init() {
 		})
 
 	random := NewMenuButton("Start with random patterns",
+		func(args *widget.ButtonClickedEventArgs) {
+			scene.Config.NewSeed()
+			scene.Config.Empty = false
+			scene.Config.Restart = true
+			scene.Leave()
+		})
+
+	same := NewMenuButton("Restart same soup",
 		func(args *widget.ButtonClickedEventArgs) {
 			scene.Config.Empty = false
 			scene.Config.Restart = true
@@ -99,6 +108,15 @@ func (scene *SceneMenu) Init() {
 	copy := NewMenuButton("Save Copy as RLE",
 		func(args *widget.ButtonClickedEventArgs) {
 			scene.Config.Markmode = true
+			scene.Config.MarkFormat = rle.FORMAT_RLE
+			scene.Config.Paused = true
+			scene.Leave()
+		})
+
+	cells := NewMenuButton("Save Copy as Cells",
+		func(args *widget.ButtonClickedEventArgs) {
+			scene.Config.Markmode = true
+			scene.Config.MarkFormat = rle.FORMAT_CELLS
 			scene.Config.Paused = true
 			scene.Leave()
 		})
@@ -129,9 +147,11 @@ func (scene *SceneMenu) Init() {
 
 	rowContainer.AddChild(empty)
 	rowContainer.AddChild(random)
+	rowContainer.AddChild(same)
 	rowContainer.AddChild(separator1)
 	rowContainer.AddChild(options)
 	rowContainer.AddChild(copy)
+	rowContainer.AddChild(cells)
 	rowContainer.AddChild(bindings)
 	rowContainer.AddChild(separator2)
 	rowContainer.AddChild(cancel)
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"fmt"
 	"image/color"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/ebitenui/ebitenui"
 	"github.com/ebitenui/ebitenui/widget"
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
+	"github.com/tlinden/golsky/engine"
 )
 
 type SceneOptions struct {
@@ -17,6 +23,18 @@ type SceneOptions struct {
 	Whoami    SceneName
 	Ui        *ebitenui.UI
 	FontColor color.RGBA
+
+	// rule editor: text input, validation result and birth/survive matrix
+	RuleInput   *widget.TextInput
+	RuleStatus  *widget.Text
+	RuleToggles [2][9]*widget.LabeledCheckbox
+	updating    bool // matrix is being updated, don't react on changes
+	matrix      bool // the rule shown can be edited with the matrix
+
+	// size editor: width, height, cellsize and density
+	SizeInputs [4]*widget.TextInput
+	SizeStatus *widget.Text
+	Centered   bool // keep the pattern centered when resizing
 }
 
 func NewOptionsScene(game *Game, config *Config) Scene {
@@ -56,7 +74,14 @@ func (scene *SceneOptions) IsPrimary() bool {
 func (scene *SceneOptions) Update() error {
 	scene.Ui.Update()
 
-	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+	// q may be part of a rule being typed, the size inputs take the
+	// keys as well
+	typing := scene.RuleInput.IsFocused()
+	for _, input := range scene.SizeInputs {
+		typing = typing || input.IsFocused()
+	}
+
+	if inpututil.IsKeyJustPressed(ebiten.KeyEscape) || (inpututil.IsKeyJustPressed(ebiten.KeyQ) && !typing) {
 		scene.SetNext(Play)
 	}
 
@@ -103,10 +128,28 @@ func (scene *SceneOptions) Init() {
 			scene.Config.ToggleEvolution()
 		})
 
-	wrap := NewCheckbox("Wrap around edges",
+	var wrap *widget.LabeledCheckbox
+
+	wrap = NewCheckbox("Wrap around edges",
 		scene.Config.Wrap,
 		func(args *widget.CheckboxChangedEventArgs) {
-			scene.Config.ToggleWrap()
+			if err := scene.Config.SetWrap(args.State == widget.WidgetChecked); err != nil {
+				// the engine in use can't wrap, keep the current mode
+				log.Printf("can't change wrap around mode: %s", err)
+
+				state := widget.WidgetUnchecked
+				if scene.Config.Wrap {
+					state = widget.WidgetChecked
+				}
+
+				wrap.SetState(state)
+			}
+		})
+
+	hexoffset := NewCheckbox("Hexagonal offset",
+		scene.Config.HexOffset,
+		func(args *widget.CheckboxChangedEventArgs) {
+			scene.Config.ToggleHexOffset()
 		})
 
 	themenames := make([]string, len(THEMES))
@@ -128,25 +171,79 @@ func (scene *SceneOptions) Init() {
 	combocontainer.AddChild(themes)
 	combocontainer.AddChild(themelabel)
 
+	// rules which are not registered can't be selected again
+	rulenames := engine.RuleNames()
+	current := scene.Config.Rule.Name
+	if current == "" {
+		current = scene.Config.Rule.Definition
+		rulenames = append([]string{current}, rulenames...)
+	}
+
+	ruledescription := NewLabel(RuleDescription(current))
+
+	rules := NewCombobox(
+		rulenames,
+		current,
+		func(args *widget.ListComboButtonEntrySelectedEventArgs) {
+			name := args.Entry.(ListEntry).Name
+			if name == scene.Config.Rule.Name || name == scene.Config.Rule.Definition {
+				return
+			}
+
+			if err := scene.Config.SwitchRule(name); err != nil {
+				ruledescription.Label = err.Error()
+				return
+			}
+
+			ruledescription.Label = RuleDescription(name)
+			scene.ShowRule()
+		})
+
+	rulelabel := NewLabel("Rules")
+	rulecontainer := NewColumnContainer()
+	rulecontainer.AddChild(rules)
+	rulecontainer.AddChild(rulelabel)
+
 	separator := NewSeparator(3)
 	separator2 := NewSeparator(3)
+	separator3 := NewSeparator(3)
 
 	cancel := NewMenuButton("Close",
 		func(args *widget.ButtonClickedEventArgs) {
 			scene.SetNext(scene.Prev)
 		})
 
-	rowContainer.AddChild(pause)
-	rowContainer.AddChild(debugging)
-	rowContainer.AddChild(gridlines)
-	rowContainer.AddChild(evolution)
-	rowContainer.AddChild(wrap)
+	// the rule editor goes into a second column
+	settings := NewVerticalContainer()
+
+	settings.AddChild(pause)
+	settings.AddChild(debugging)
+	settings.AddChild(gridlines)
+	settings.AddChild(evolution)
+	settings.AddChild(wrap)
+	settings.AddChild(hexoffset)
+
+	settings.AddChild(separator)
 
-	rowContainer.AddChild(separator)
+	settings.AddChild(combocontainer)
 
-	rowContainer.AddChild(combocontainer)
+	settings.AddChild(separator2)
 
-	rowContainer.AddChild(separator2)
+	settings.AddChild(rulecontainer)
+	settings.AddChild(ruledescription)
+
+	editor := NewVerticalContainer()
+	scene.InitRuleEditor(editor)
+	editor.AddChild(NewSeparator(3))
+	scene.InitSizeEditor(editor)
+
+	columns := NewColumnContainer()
+	columns.AddChild(settings)
+	columns.AddChild(editor)
+
+	rowContainer.AddChild(columns)
+
+	rowContainer.AddChild(separator3)
 
 	rowContainer.AddChild(cancel)
 
@@ -155,3 +252,211 @@ func (scene *SceneOptions) Init() {
 	}
 
 }
+
+// description of a registered rule, the definition otherwise
+func RuleDescription(name string) string {
+	named, ok := engine.LookupRule(name)
+	if !ok {
+		return name
+	}
+
+	return named.Definition + ": " + named.Description
+}
+
+// add the rule editor: a  text input, which is validated while typing
+// and applied with enter or the apply button, and a matrix of neighbor
+// counts for birth and survival, which builds a B/S rule
+func (scene *SceneOptions) InitRuleEditor(container *widget.Container) {
+	scene.RuleStatus = NewLabel("")
+
+	scene.RuleInput = NewTextInput(
+		scene.Config.Rule.Definition, 250,
+		func(args *widget.TextInputChangedEventArgs) {
+			scene.ValidateRule(args.InputText)
+		},
+		func(args *widget.TextInputChangedEventArgs) {
+			scene.ApplyRule(args.InputText)
+		})
+
+	matrix := NewGridContainer(10)
+
+	for row, prefix := range []string{"B", "S"} {
+		matrix.AddChild(NewLabel(prefix))
+
+		for count := range scene.RuleToggles[row] {
+			scene.RuleToggles[row][count] = NewCheckbox(fmt.Sprintf("%d", count), false,
+				func(args *widget.CheckboxChangedEventArgs) {
+					if !scene.updating && scene.matrix {
+						scene.RuleInput.SetText(scene.MatrixRule())
+						scene.ValidateRule(scene.RuleInput.GetText())
+					}
+				})
+
+			matrix.AddChild(scene.RuleToggles[row][count])
+		}
+	}
+
+	apply := NewMenuButton("Apply rule",
+		func(args *widget.ButtonClickedEventArgs) {
+			scene.ApplyRule(scene.RuleInput.GetText())
+		})
+
+	container.AddChild(NewLabel("Rule"))
+	container.AddChild(scene.RuleInput)
+	container.AddChild(scene.RuleStatus)
+	container.AddChild(matrix)
+	container.AddChild(apply)
+
+	scene.ShowRule()
+}
+
+// show the current rule in the editor
+func (scene *SceneOptions) ShowRule() {
+	scene.RuleInput.SetText(scene.Config.Rule.Definition)
+	scene.ShowMatrix(scene.Config.Rule)
+	scene.RuleStatus.Label = "current rule"
+}
+
+// check the rule typed so far and show the result
+func (scene *SceneOptions) ValidateRule(definition string) {
+	rule, err := scene.Config.CheckRule(definition)
+	if err != nil {
+		scene.RuleStatus.Label = err.Error()
+		return
+	}
+
+	scene.RuleStatus.Label = "valid: " + rule.Definition
+	scene.ShowMatrix(rule)
+}
+
+// switch the running simulation to the rule
+func (scene *SceneOptions) ApplyRule(definition string) {
+	if err := scene.Config.SwitchRule(definition); err != nil {
+		scene.RuleStatus.Label = err.Error()
+		return
+	}
+
+	scene.ShowRule()
+	scene.RuleStatus.Label = "applied: " + scene.Config.Rule.Definition
+}
+
+// check the neighbor counts of the rule in the matrix. Rules which
+// aren't made of neighbor counts disable it.
+func (scene *SceneOptions) ShowMatrix(rule *engine.Rule) {
+	scene.updating = true
+	defer func() { scene.updating = false }()
+
+	scene.matrix = IsTotalistic(rule)
+
+	for row, list := range [][]uint8{rule.Birth, rule.Death} {
+		for count, toggle := range scene.RuleToggles[row] {
+			state := widget.WidgetUnchecked
+			if scene.matrix && slices.Contains(list, uint8(count)) {
+				state = widget.WidgetChecked
+			}
+
+			toggle.SetState(state)
+			toggle.Checkbox().GetWidget().Disabled = !scene.matrix
+		}
+	}
+}
+
+// true if the rule only depends on the number of neighbors, Hensel,
+// Larger than Life, one-dimensional and rule file rules can't be built
+// with the matrix
+func IsTotalistic(rule *engine.Rule) bool {
+	return !rule.NonTotalistic && !rule.IsLargerThanLife() && !rule.Elementary && rule.Table == nil
+}
+
+// build a B/S rule from the  matrix, the number of states and the
+// neighborhood of the current rule are kept
+func (scene *SceneOptions) MatrixRule() string {
+	var counts [2]string
+
+	for row := range scene.RuleToggles {
+		for count, toggle := range scene.RuleToggles[row] {
+			if toggle.Checkbox().State() == widget.WidgetChecked {
+				counts[row] += fmt.Sprintf("%d", count)
+			}
+		}
+	}
+
+	rule := "B" + counts[0] + "/S" + counts[1]
+	current := scene.Config.Rule
+
+	if current.IsGenerations() && !current.IsLargerThanLife() && current.Table == nil {
+		rule += fmt.Sprintf("/C%d", current.States)
+	}
+
+	rule += engine.NeighborhoodSuffix(current.Neighborhood)
+
+	return rule
+}
+
+// add the size editor: width,  height, cell size and density, applied
+// with the apply button. The pattern is kept centered or at the top left.
+func (scene *SceneOptions) InitSizeEditor(container *widget.Container) {
+	scene.SizeStatus = NewLabel("")
+	scene.Centered = true
+
+	inputs := NewGridContainer(4)
+	labels := []string{"Width", "Height", "Cellsize", "Density"}
+
+	for idx, value := range scene.SizeValues() {
+		scene.SizeInputs[idx] = NewTextInput(strconv.Itoa(value), 50,
+			func(args *widget.TextInputChangedEventArgs) {},
+			func(args *widget.TextInputChangedEventArgs) {
+				scene.ApplySize()
+			})
+
+		inputs.AddChild(NewLabel(labels[idx]))
+		inputs.AddChild(scene.SizeInputs[idx])
+	}
+
+	centered := NewCheckbox("Keep pattern centered",
+		scene.Centered,
+		func(args *widget.CheckboxChangedEventArgs) {
+			scene.Centered = !scene.Centered
+		})
+
+	apply := NewMenuButton("Apply size",
+		func(args *widget.ButtonClickedEventArgs) {
+			scene.ApplySize()
+		})
+
+	container.AddChild(inputs)
+	container.AddChild(centered)
+	container.AddChild(scene.SizeStatus)
+	container.AddChild(apply)
+}
+
+// the current size settings in the order of the size inputs
+func (scene *SceneOptions) SizeValues() []int {
+	return []int{
+		scene.Config.Width, scene.Config.Height,
+		scene.Config.Cellsize, scene.Config.Density,
+	}
+}
+
+// resize the grid using the values of the size inputs
+func (scene *SceneOptions) ApplySize() {
+	values := make([]int, len(scene.SizeInputs))
+
+	for idx, input := range scene.SizeInputs {
+		value, err := strconv.Atoi(strings.TrimSpace(input.GetText()))
+		if err != nil {
+			scene.SizeStatus.Label = "numbers expected"
+			return
+		}
+
+		values[idx] = value
+	}
+
+	err := scene.Config.Resize(values[0], values[1], values[2], values[3], scene.Centered)
+	if err != nil {
+		scene.SizeStatus.Label = err.Error()
+		return
+	}
+
+	scene.SizeStatus.Label = fmt.Sprintf("resized to %dx%d", values[0], values[1])
+}
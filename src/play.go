@@ -4,12 +4,13 @@ import (
 	"fmt"
 	"image"
 	"log"
-	"sync"
+	"math"
 	"unsafe"
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 	"github.com/hajimehoshi/ebiten/v2/vector"
+	"github.com/tlinden/golsky/engine"
 	"github.com/tlinden/golsky/rle"
 	"golang.org/x/image/math/f64"
 )
@@ -19,24 +20,9 @@ type Images struct {
 }
 
 const (
-	DEBUG_FORMAT = "FPS: %0.2f, TPG: %d, M: %0.2fMB, Generations: %d\nScale: %.02f, Zoom: %d, Cam: %.02f,%.02f Cursor: %d,%d  %s"
+	DEBUG_FORMAT = "FPS: %0.2f, TPG: %d, M: %0.2fMB, Generations: %d, Active: %s, Seed: %d\nScale: %.02f, Zoom: %d, Cam: %.02f,%.02f Cursor: %d,%d  %s"
 )
 
-type History struct {
-	Age [][]int64
-}
-
-func NewHistory(height, width int) History {
-	hist := History{}
-
-	hist.Age = make([][]int64, height)
-	for y := 0; y < height; y++ {
-		hist.Age[y] = make([]int64, width)
-	}
-
-	return hist
-}
-
 type ScenePlay struct {
 	Game   *Game
 	Config *Config
@@ -46,23 +32,24 @@ type ScenePlay struct {
 
 	Clear bool
 
-	Grids         []*Grid       // 2 grids: one current, one next
-	History       History       // holds state of past dead cells for evolution traces
-	Index         int           // points to current grid
-	Generations   int64         // Stats
-	TicksElapsed  int           // tick counter for game speed
-	Camera        Camera        // for zoom+move
-	World, Cache  *ebiten.Image // actual image we render to
-	WheelTurned   bool          // when user turns wheel multiple times, zoom faster
-	Dragging      bool          // middle mouse is pressed, move canvas
-	LastCursorPos []float64     // used to check if the user is dragging
-	MarkTaken     bool          // true when mouse1 pressed
-	MarkDone      bool          // true when mouse1 released, copy cells between Mark+Point
-	Mark, Point   image.Point   // area to marks+save
-	RunOneStep    bool          // mutable flags from config
-	TPG           int           // current game speed (ticks per game)
+	Engine        engine.Stepper // the simulation engine holding the current generation
+	Generations   int64          // Stats
+	TicksElapsed  int            // tick counter for game speed
+	Camera        Camera         // for zoom+move
+	World, Cache  *ebiten.Image  // actual image we render to
+	InvertedCache *ebiten.Image  // background of B0 rules in the inverted phase
+	WheelTurned   bool           // when user turns wheel multiple times, zoom faster
+	Dragging      bool           // middle mouse is pressed, move canvas
+	LastCursorPos []float64      // used to check if the user is dragging
+	MarkTaken     bool           // true when mouse1 pressed
+	MarkDone      bool           // true when mouse1 released, copy cells between Mark+Point
+	Mark, Point   image.Point    // area to marks+save
+	RunOneStep    bool           // mutable flags from config
+	TPG           int            // current game speed (ticks per game)
 	Theme         Theme
-	RuleCheckFunc func(uint8, uint8) uint8
+
+	History        *History // undo, redo and rewind
+	GenerationBase int64    // generation the engine started with, see RestoreFrame()
 }
 
 func NewPlayScene(game *Game, config *Config) Scene {
@@ -100,46 +87,6 @@ func (scene *ScenePlay) SetNext(next SceneName) {
 	scene.Next = next
 }
 
-/* The standard Scene of Life is symbolized in rule-string notation
- * as B3/S23 (23/3 here).  A cell  is born if it has exactly three
- * neighbors,  survives if it  has two or three  living neighbors,
- * and  dies otherwise.
- * we  abbreviate the calculation: if  state is 0 and  3 neighbors
- * are a life, check will be just  3. If the cell is alive, 9 will
- * be added  to the life neighbors (to avoid  a collision with the
- * result 3), which will be 11|12 in case of 2|3 life neighbors.
- */
-func (scene *ScenePlay) CheckRuleB3S23(state uint8, neighbors uint8) uint8 {
-	switch (9 * state) + neighbors {
-	case 11:
-		fallthrough
-	case 12:
-		fallthrough
-	case 3:
-		return Alive
-	}
-
-	return Dead
-}
-
-/*
- * The generic  rule checker is able  to calculate cell state  for any
- * GOL rul, including B3/S23.
- */
-func (scene *ScenePlay) CheckRuleGeneric(state uint8, neighbors uint8) uint8 {
-	var nextstate uint8
-
-	if state != 1 && Contains(scene.Config.Rule.Birth, neighbors) {
-		nextstate = Alive
-	} else if state == 1 && Contains(scene.Config.Rule.Death, neighbors) {
-		nextstate = Alive
-	} else {
-		nextstate = Dead
-	}
-
-	return nextstate
-}
-
 // Update all cells according to the current rule
 func (scene *ScenePlay) UpdateCells() {
 	// count ticks so we know when to actually run
@@ -150,52 +97,20 @@ func (scene *ScenePlay) UpdateCells() {
 		return
 	}
 
-	// next grid index, we just xor 0|1 to 1|0
-	next := scene.Index ^ 1
-
-	var wg sync.WaitGroup
-	wg.Add(scene.Config.Height)
-
-	width := scene.Config.Width
-	height := scene.Config.Height
-
-	// compute life status of cells
-	for y := 0; y < height; y++ {
+	scene.Engine.Step(scene.Config.StepSize())
 
-		go func() {
-			defer wg.Done()
-
-			for x := 0; x < width; x++ {
-				state := scene.Grids[scene.Index].Data[y+STRIDE*x] // 0|1 == dead or alive
-				neighbors := scene.Grids[scene.Index].Counter(x, y)
-
-				// actually apply the current rules
-				nextstate := scene.RuleCheckFunc(state, neighbors)
-
-				// change state of current cell in next grid
-				scene.Grids[next].Data[y+STRIDE*x] = nextstate
+	// global stats counter
+	scene.Generations = scene.GenerationBase + scene.Engine.Generation()
 
-				if scene.Config.ShowEvolution {
-					// set history  to current generation so we  can infer the
-					// age of the cell's state  during rendering and use it to
-					// deduce the color to use if evolution tracing is enabled
-					// 60FPS:
-					if state != nextstate {
-						scene.History.Age[y][x] = scene.Generations
-					}
-				}
-			}
-		}()
+	switch {
+	case scene.RecordsSteps():
+		scene.RecordHistory(FRAME_STEP)
+	case scene.Config.StepSize() == 1 && scene.Generations%HISTORY_INTERVAL == 0:
+		// without --record-steps running generations can still be
+		// rewound in larger steps
+		scene.RecordHistory(FRAME_STEP)
 	}
 
-	wg.Wait()
-
-	// switch grid for rendering
-	scene.Index ^= 1
-
-	// global stats counter
-	scene.Generations++
-
 	if scene.Config.RunOneStep {
 		// setp-wise mode, halt the game
 		scene.Config.RunOneStep = false
@@ -207,7 +122,9 @@ func (scene *ScenePlay) UpdateCells() {
 
 func (scene *ScenePlay) Reset() {
 	scene.Config.Paused = true
-	scene.InitGrid()
+	if err := scene.InitGrid(); err != nil {
+		log.Printf("failed to reset the grid: %s", err)
+	}
 	scene.Config.Paused = false
 }
 
@@ -228,6 +145,11 @@ func (scene *ScenePlay) CheckInput() {
 	case inpututil.IsKeyJustPressed(ebiten.KeyO):
 		scene.SetNext(Options)
 	case inpututil.IsKeyJustPressed(ebiten.KeyC):
+		scene.Config.MarkFormat = rle.FORMAT_RLE
+		if ebiten.IsKeyPressed(ebiten.KeyShift) {
+			scene.Config.MarkFormat = rle.FORMAT_CELLS
+		}
+
 		scene.Config.Markmode = true
 		scene.Config.Drawmode = false
 		scene.Config.Paused = true
@@ -256,6 +178,8 @@ func (scene *ScenePlay) CheckInput() {
 		scene.SaveState()
 	case inpututil.IsKeyJustPressed(ebiten.KeyD):
 		scene.Config.Debug = !scene.Config.Debug
+	case inpututil.IsKeyJustPressed(ebiten.KeyP):
+		scene.Config.ShowInfo = !scene.Config.ShowInfo
 	}
 
 	if scene.Config.Paused {
@@ -265,6 +189,28 @@ func (scene *ScenePlay) CheckInput() {
 	}
 }
 
+// undo and redo with ctrl-z and ctrl-y, b steps back one generation,
+// holding , or . scrubs through the history
+func (scene *ScenePlay) CheckHistoryInput() {
+	control := ebiten.IsKeyPressed(ebiten.KeyControl) || ebiten.IsKeyPressed(ebiten.KeyMeta)
+	shift := ebiten.IsKeyPressed(ebiten.KeyShift)
+
+	switch {
+	case control && shift && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		scene.RestoreFrame(scene.History.Index + 1)
+	case control && inpututil.IsKeyJustPressed(ebiten.KeyZ):
+		scene.RestoreFrame(scene.History.Index - 1)
+	case control && inpututil.IsKeyJustPressed(ebiten.KeyY):
+		scene.RestoreFrame(scene.History.Index + 1)
+	case inpututil.IsKeyJustPressed(ebiten.KeyB):
+		scene.RestoreFrame(scene.History.PreviousGeneration())
+	case ebiten.IsKeyPressed(ebiten.KeyComma):
+		scene.RestoreFrame(scene.History.Index - 1)
+	case ebiten.IsKeyPressed(ebiten.KeyPeriod):
+		scene.RestoreFrame(scene.History.Index + 1)
+	}
+}
+
 func (scene *ScenePlay) CheckDrawingInput() {
 	if scene.Config.Drawmode {
 		switch {
@@ -338,11 +284,16 @@ func (scene *ScenePlay) CheckDraggingInput() {
 
 }
 
+// return the cell  under the mouse cursor. We have  to round towards
+// negative  infinity, otherwise  cells left  or above  the origin  of an
+// unbounded plane would be off by one.
 func (scene *ScenePlay) GetWorldCursorPos() image.Point {
 	worldX, worldY := scene.Camera.ScreenToWorld(ebiten.CursorPosition())
+	y := int(math.Floor(worldY / float64(scene.Config.Cellsize)))
+
 	return image.Point{
-		X: int(worldX) / scene.Config.Cellsize,
-		Y: int(worldY) / scene.Config.Cellsize,
+		X: int(math.Floor((worldX - scene.RowOffset(y)) / float64(scene.Config.Cellsize))),
+		Y: y,
 	}
 }
 
@@ -375,15 +326,27 @@ func (scene *ScenePlay) CheckMarkInput() {
 
 func (scene *ScenePlay) SaveState() {
 	filename := GetFilename(scene.Generations)
-	err := scene.Grids[scene.Index].SaveState(filename, scene.Config.Rule.Definition)
+
+	// a bounded universe is saved as a whole, otherwise we only
+	// save the area containing life cells. Cells of a bounded universe
+	// are saved relative to its center.
+	rect := image.Rect(0, 0, scene.Config.Width, scene.Config.Height)
+	origin := image.Pt(scene.Config.Width/2, scene.Config.Height/2)
+	if scene.Config.Unbounded {
+		rect, origin = scene.Engine.Bounds(), image.Point{}
+	}
+
+	filename, err := SaveState(filename, scene.Config.Rule.Definition, scene.Config.StateFormat, scene.Config.Seed,
+		rect, origin, scene.Engine)
 	if err != nil {
 		log.Printf("failed to save game state to %s: %s", filename, err)
+		return
 	}
 	log.Printf("saved game state to %s at generation %d\n", filename, scene.Generations)
 }
 
 func (scene *ScenePlay) SaveRectRLE() {
-	filename := GetFilenameRLE(scene.Generations)
+	filename := GetFilenameRect(scene.Generations, scene.Config.MarkFormat)
 
 	if scene.Mark.X == scene.Point.X || scene.Mark.Y == scene.Point.Y {
 		log.Printf("can't save non-rectangle\n")
@@ -415,17 +378,15 @@ func (scene *ScenePlay) SaveRectRLE() {
 		height = scene.Mark.Y - scene.Point.Y
 	}
 
-	grid := make([][]uint8, height)
+	rect := image.Rect(startx, starty, startx+width, starty+height)
 
-	for y := 0; y < height; y++ {
-		grid[y] = make([]uint8, width)
-
-		for x := 0; x < width; x++ {
-			grid[y][x] = scene.Grids[scene.Index].Data[(y+starty)+STRIDE*(x+startx)]
-		}
+	var err error
+	if scene.Config.MarkFormat == rle.FORMAT_CELLS {
+		err = SaveCells(filename, scene.Config.RLE, rect, scene.Engine)
+	} else {
+		err = SaveRLE(filename, scene.Config.Rule.Definition, scene.Config.RLE, rect, scene.Engine)
 	}
 
-	err := rle.StoreGridToRLE(grid, filename, scene.Config.Rule.Definition, width, height)
 	if err != nil {
 		log.Printf("failed to save rect to %s: %s\n", filename, err)
 	} else {
@@ -437,15 +398,32 @@ func (scene *ScenePlay) SaveRectRLE() {
 func (scene *ScenePlay) Update() error {
 	if scene.Config.Restart {
 		scene.Config.Restart = false
-		scene.Generations = 0
-		scene.InitGrid()
+		if err := scene.InitGrid(); err != nil {
+			// keep playing with the old engine
+			log.Printf("failed to restart: %s", err)
+			return nil
+		}
+
 		scene.InitCache()
+		scene.InitHistory()
 		return nil
 	}
 
+	if scene.Config.RestartSize {
+		scene.Config.RestartSize = false
+		scene.ResizeGrid()
+		return nil
+	}
+
+	if scene.Config.RestartRule {
+		scene.Config.RestartRule = false
+		scene.InitRuleCheckFunc()
+	}
+
 	if scene.Config.RestartCache {
 		scene.Config.RestartCache = false
 		scene.Theme = scene.Config.ThemeManager.GetCurrentTheme()
+		scene.InitWorld()
 		scene.InitCache()
 		return nil
 	}
@@ -455,6 +433,7 @@ func (scene *ScenePlay) Update() error {
 	}
 
 	scene.CheckInput()
+	scene.CheckHistoryInput()
 	scene.CheckDrawingInput()
 	scene.CheckDraggingInput()
 	scene.CheckMarkInput()
@@ -469,91 +448,278 @@ func (scene *ScenePlay) Update() error {
 // set a cell to alive or dead
 func (scene *ScenePlay) ToggleCellOnCursorPos() {
 	// use cursor pos relative to the world
-	worldX, worldY := scene.Camera.ScreenToWorld(ebiten.CursorPosition())
-	x := int(worldX) / scene.Config.Cellsize
-	y := int(worldY) / scene.Config.Cellsize
+	pos := scene.GetWorldCursorPos()
+	x, y := pos.X, pos.Y
+
+	// the HashLife engine is unbounded as well, but we only show the grid area
+	if !scene.Config.Unbounded &&
+		(x < 0 || y < 0 || x >= scene.Config.Width || y >= scene.Config.Height) {
+		return
+	}
 
-	if x > -1 && y > -1 && x < scene.Config.Width && y < scene.Config.Height {
-		scene.Grids[scene.Index].Data[y+STRIDE*x] ^= 1
-		scene.History.Age[y][x] = 1
+	state := uint8(engine.Alive)
+	if scene.Engine.Get(x, y) != engine.Dead {
+		state = engine.Dead
 	}
+
+	// cells of rule files like Wireworld cycle through all states
+	if scene.Config.Rule.Table != nil {
+		state = uint8((int(scene.Engine.Get(x, y)) + 1) % scene.Config.Rule.States)
+	}
+
+	// undo goes back to the generation the cell was edited in
+	scene.RecordRunning()
+	scene.Engine.Set(x, y, state)
+
+	scene.RecordHistory(FRAME_EDIT)
 }
 
 // draw the new grid state
 func (scene *ScenePlay) Draw(screen *ebiten.Image) {
+	if scene.Config.Unbounded {
+		scene.DrawUnbounded(screen)
+		return
+	}
+
 	// we  fill the whole  screen with  a background color,  the cells
 	// themselfes will be 1px smaller as their nominal size, producing
 	// a nice grey grid with grid lines
 	op := &ebiten.DrawImageOptions{}
 
 	op.GeoM.Translate(0, 0)
-	scene.World.DrawImage(scene.Cache, op)
 
-	for y := 0; y < scene.Config.Height; y++ {
-		for x := 0; x < scene.Config.Width; x++ {
+	if scene.Inverted() {
+		scene.World.DrawImage(scene.InvertedCache, op)
+	} else {
+		scene.World.DrawImage(scene.Cache, op)
+	}
+
+	tracer, traced := scene.Engine.(engine.Tracer)
+
+	// the traces of B0 rules would only flash
+	if scene.Config.ShowEvolution && traced && !scene.Inverted() {
+		scene.DrawEvolution(tracer, op)
+	} else {
+		scene.Engine.Each(image.Rect(0, 0, scene.Config.Width, scene.Config.Height), func(x, y int) {
 			op.GeoM.Reset()
-			op.GeoM.Translate(
-				float64(x*scene.Config.Cellsize),
-				float64(y*scene.Config.Cellsize),
-			)
-
-			if scene.Config.ShowEvolution {
-				scene.DrawEvolution(screen, x, y, op)
-			} else {
-				if scene.Grids[scene.Index].Data[y+STRIDE*x] == 1 {
-					scene.World.DrawImage(scene.Theme.Tile(ColLife), op)
-				}
-			}
-		}
+			op.GeoM.Translate(scene.CellPosition(x, y))
+
+			scene.World.DrawImage(scene.CellTile(x, y), op)
+		})
 	}
 
-	scene.DrawMark(scene.World)
+	scene.DrawMark(scene.World, ebiten.GeoM{})
 
 	scene.Camera.Render(scene.World, screen)
 
 	scene.DrawDebug(screen)
+	scene.DrawInfo(screen)
 }
 
-func (scene *ScenePlay) DrawEvolution(screen *ebiten.Image, x, y int, op *ebiten.DrawImageOptions) {
-	age := scene.Generations - scene.History.Age[y][x]
+// There's  no world  image on  an unbounded  plane, we  only draw  the
+// visible cells directly onto the screen using the camera matrix.
+func (scene *ScenePlay) DrawUnbounded(screen *ebiten.Image) {
+	if scene.Inverted() {
+		screen.Fill(scene.Theme.Color(ColLife))
+	} else {
+		screen.Fill(scene.Theme.Color(ColDead))
+	}
 
-	switch scene.Grids[scene.Index].Data[y+STRIDE*x] {
-	case Alive:
-		if age > 50 && scene.Config.ShowEvolution {
-			scene.World.DrawImage(scene.Theme.Tile(ColOld), op)
-		} else {
-			scene.World.DrawImage(scene.Theme.Tile(ColLife), op)
+	matrix := scene.Camera.worldMatrix()
+	view := scene.VisibleRect()
+	op := &ebiten.DrawImageOptions{}
+
+	scene.Engine.Each(view, func(x, y int) {
+		op.GeoM.Reset()
+		op.GeoM.Translate(scene.CellPosition(x, y))
+		op.GeoM.Concat(matrix)
+
+		screen.DrawImage(scene.CellTile(x, y), op)
+	})
+
+	// grid lines don't match skewed hex rows
+	if scene.Config.ShowGrid && scene.RowOffset(1) == 0 {
+		scene.DrawGridLines(screen, view, matrix)
+	}
+
+	scene.DrawMark(screen, matrix)
+
+	scene.DrawDebug(screen)
+	scene.DrawInfo(screen)
+}
+
+// return the world area currently visible on screen in cells
+func (scene *ScenePlay) VisibleRect() image.Rectangle {
+	cellsize := float64(scene.Config.Cellsize)
+
+	minX, minY := scene.Camera.ScreenToWorld(0, 0)
+	maxX, maxY := scene.Camera.ScreenToWorld(scene.Config.ScreenWidth, scene.Config.ScreenHeight)
+
+	// skewed hex rows are shifted to the left
+	minX -= scene.RowOffset(int(math.Floor(minY / cellsize)))
+	maxX -= scene.RowOffset(int(math.Ceil(maxY / cellsize)))
+
+	return image.Rect(
+		int(math.Floor(minX/cellsize)), int(math.Floor(minY/cellsize)),
+		int(math.Ceil(maxX/cellsize))+1, int(math.Ceil(maxY/cellsize))+1,
+	)
+}
+
+// draw grid lines  on an unbounded plane, but only  if the cells are
+// large enough on screen, otherwise we'd just paint everything grey
+func (scene *ScenePlay) DrawGridLines(screen *ebiten.Image, view image.Rectangle, matrix ebiten.GeoM) {
+	if float64(scene.Config.ScreenWidth)/float64(view.Dx()) < 4 {
+		return
+	}
+
+	cellsize := float64(scene.Config.Cellsize)
+	color := scene.Theme.Color(ColGrid)
+
+	for x := view.Min.X; x <= view.Max.X; x++ {
+		fromX, fromY := matrix.Apply(float64(x)*cellsize, float64(view.Min.Y)*cellsize)
+		toX, toY := matrix.Apply(float64(x)*cellsize, float64(view.Max.Y)*cellsize)
+
+		vector.StrokeLine(screen, float32(fromX), float32(fromY), float32(toX), float32(toY), 1, color, false)
+	}
+
+	for y := view.Min.Y; y <= view.Max.Y; y++ {
+		fromX, fromY := matrix.Apply(float64(view.Min.X)*cellsize, float64(y)*cellsize)
+		toX, toY := matrix.Apply(float64(view.Max.X)*cellsize, float64(y)*cellsize)
+
+		vector.StrokeLine(screen, float32(fromX), float32(fromY), float32(toX), float32(toY), 1, color, false)
+	}
+}
+
+// Hexagonal rules emulate a hex grid  by skewing it, the NE and SW
+// neighbors are  not part of  the neighborhood.  To  make it  look like
+// one, every row is shifted half a cell to the left of the row above.
+// The rows of a bounded grid are shifted to the right instead, so that
+// the world image starts at 0.
+func (scene *ScenePlay) RowOffset(y int) float64 {
+	if !scene.Config.HexOffset || scene.Config.Rule.Neighborhood != engine.HEXAGONAL {
+		return 0
+	}
+
+	if scene.Config.Unbounded {
+		return -float64(y*scene.Config.Cellsize) / 2
+	}
+
+	return float64((scene.Config.Height-1-y)*scene.Config.Cellsize) / 2
+}
+
+// return the pixel position of a cell in the world
+func (scene *ScenePlay) CellPosition(x, y int) (float64, float64) {
+	return float64(x*scene.Config.Cellsize) + scene.RowOffset(y),
+		float64(y * scene.Config.Cellsize)
+}
+
+// true if the  background of a  B0 rule is alive,  the engine then
+// stores dead cells instead of life ones
+func (scene *ScenePlay) Inverted() bool {
+	inverter, ok := scene.Engine.(engine.Inverter)
+
+	return ok && inverter.Inverted()
+}
+
+// return the tile to draw a non-dead cell with, which depends on its
+// state if the rule has more than two
+func (scene *ScenePlay) CellTile(x, y int) *ebiten.Image {
+	if scene.Inverted() {
+		return scene.Theme.Tile(ColDead)
+	}
+
+	// rule files may define their own colors
+	if table := scene.Config.Rule.Table; table != nil {
+		if col, ok := table.Colors[scene.Engine.Get(x, y)]; ok {
+			return scene.Theme.ColorTile(col)
 		}
-	case Dead:
-		// only draw dead cells in case evolution trace is enabled
-		if scene.History.Age[y][x] > 1 && scene.Config.ShowEvolution {
-			switch {
-			case age < 10:
-				scene.World.DrawImage(scene.Theme.Tile(ColAge1), op)
-			case age < 20:
-				scene.World.DrawImage(scene.Theme.Tile(ColAge2), op)
-			case age < 30:
-				scene.World.DrawImage(scene.Theme.Tile(ColAge3), op)
+	}
+
+	if !scene.Config.Rule.IsGenerations() {
+		return scene.Theme.Tile(ColLife)
+	}
+
+	return scene.Theme.StateTile(scene.Engine.Get(x, y), scene.Config.Rule.States)
+}
+
+// draw  life cells and  the traces of  dead ones, only  available if
+// the engine keeps track of cell changes
+func (scene *ScenePlay) DrawEvolution(tracer engine.Tracer, op *ebiten.DrawImageOptions) {
+	for y := 0; y < scene.Config.Height; y++ {
+		for x := 0; x < scene.Config.Width; x++ {
+			changed := tracer.Age(x, y)
+			// ages are counted by the engine, which starts at 0 after
+			// undo, rewind and resize
+			age := scene.Engine.Generation() - changed
+
+			op.GeoM.Reset()
+			op.GeoM.Translate(scene.CellPosition(x, y))
+
+			switch scene.Engine.Get(x, y) {
+			case engine.Alive:
+				if age > 50 {
+					scene.World.DrawImage(scene.Theme.Tile(ColOld), op)
+				} else {
+					scene.World.DrawImage(scene.Theme.Tile(ColLife), op)
+				}
+			case engine.Dead:
+				// only draw dead cells which have been alive before
+				if changed > 0 {
+					switch {
+					case age < 10:
+						scene.World.DrawImage(scene.Theme.Tile(ColAge1), op)
+					case age < 20:
+						scene.World.DrawImage(scene.Theme.Tile(ColAge2), op)
+					case age < 30:
+						scene.World.DrawImage(scene.Theme.Tile(ColAge3), op)
+					default:
+						scene.World.DrawImage(scene.Theme.Tile(ColAge4), op)
+					}
+				}
 			default:
-				scene.World.DrawImage(scene.Theme.Tile(ColAge4), op)
+				// dying cell of a Generations rule
+				scene.World.DrawImage(scene.CellTile(x, y), op)
 			}
 		}
 	}
 }
 
-func (scene *ScenePlay) DrawMark(screen *ebiten.Image) {
-	if scene.Config.Markmode && scene.MarkTaken {
-		x := float32(scene.Mark.X * scene.Config.Cellsize)
-		y := float32(scene.Mark.Y * scene.Config.Cellsize)
-		w := float32((scene.Point.X - scene.Mark.X) * scene.Config.Cellsize)
-		h := float32((scene.Point.Y - scene.Mark.Y) * scene.Config.Cellsize)
+// draw the marked rectangle, matrix is used to transform world pixel
+// coordinates into target coordinates
+func (scene *ScenePlay) DrawMark(target *ebiten.Image, matrix ebiten.GeoM) {
+	if !scene.Config.Markmode || !scene.MarkTaken {
+		return
+	}
+
+	cellsize := float64(scene.Config.Cellsize)
+	rect := image.Rectangle{scene.Mark, scene.Point}.Canon()
+
+	// the rows of a hex grid are shifted, see RowOffset, so the outline
+	// goes down the right edge and up the left edge row by row
+	points := []f64.Vec2{}
 
-		vector.StrokeRect(
-			scene.World,
-			x+1, y+1,
-			w, h,
-			1.0, scene.Theme.Color(ColOld), false,
-		)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		x, top := scene.CellPosition(rect.Max.X, y)
+		points = append(points, f64.Vec2{x, top}, f64.Vec2{x, top + cellsize})
+	}
+
+	for y := rect.Max.Y - 1; y >= rect.Min.Y; y-- {
+		x, top := scene.CellPosition(rect.Min.X, y)
+		points = append(points, f64.Vec2{x, top + cellsize}, f64.Vec2{x, top})
+	}
+
+	if len(points) == 0 {
+		return
+	}
+
+	points = append(points, points[0])
+	color := scene.Theme.Color(ColOld)
+
+	for idx := 1; idx < len(points); idx++ {
+		fromX, fromY := matrix.Apply(points[idx-1][0], points[idx-1][1])
+		toX, toY := matrix.Apply(points[idx][0], points[idx][1])
+
+		vector.StrokeLine(target, float32(fromX+1), float32(fromY+1), float32(toX+1), float32(toY+1), 1, color, false)
 	}
 }
 
@@ -572,10 +738,16 @@ func (scene *ScenePlay) DrawDebug(screen *ebiten.Image) {
 			paused = "-- insert --"
 		}
 
+		// not every engine keeps track of active cells
+		active := "-"
+		if tracker, ok := scene.Engine.(engine.Tracker); ok {
+			active = fmt.Sprintf("%d", tracker.ActiveCells())
+		}
+
 		x, y := ebiten.CursorPosition()
 		debug := fmt.Sprintf(
 			DEBUG_FORMAT,
-			ebiten.ActualTPS(), scene.TPG, GetMem(), scene.Generations,
+			ebiten.ActualTPS(), scene.TPG, GetMem(), scene.Generations, active, scene.Config.Seed,
 			scene.Game.Scale, scene.Camera.ZoomFactor,
 			scene.Camera.Position[0], scene.Camera.Position[1],
 			x, y,
@@ -595,56 +767,277 @@ func (scene *ScenePlay) DrawDebug(screen *ebiten.Image) {
 
 }
 
+// show the metadata of the loaded pattern in the lower left corner
+func (scene *ScenePlay) DrawInfo(screen *ebiten.Image) {
+	if !scene.Config.ShowInfo {
+		return
+	}
+
+	lines := []string{}
+	pattern := scene.Config.RLE
+
+	if pattern == nil {
+		lines = append(lines, "no pattern loaded")
+	} else {
+		if pattern.Name != "" {
+			lines = append(lines, pattern.Name)
+		}
+
+		if pattern.Author != "" {
+			lines = append(lines, "by "+pattern.Author)
+		}
+
+		lines = append(lines, pattern.Comments...)
+
+		lines = append(lines, fmt.Sprintf("Size: %dx%d, Rule: %s",
+			pattern.Width, pattern.Height, scene.Config.Rule.Definition))
+
+		if pattern.Positioned {
+			lines = append(lines, fmt.Sprintf("Offset: %d,%d", pattern.Offset.X, pattern.Offset.Y))
+		}
+	}
+
+	size := 10 + int(scene.Game.Scale*10)
+	y := screen.Bounds().Dy() - 30 - (len(lines)+1)*size
+
+	FontRenderer.Renderer.SetSizePx(size)
+	FontRenderer.Renderer.SetTarget(screen)
+
+	for idx, line := range lines {
+		FontRenderer.Renderer.SetColor(scene.Theme.Color(ColLife))
+		FontRenderer.Renderer.Draw(line, 31, y+idx*size+1)
+
+		FontRenderer.Renderer.SetColor(scene.Theme.Color(ColOld))
+		FontRenderer.Renderer.Draw(line, 30, y+idx*size)
+	}
+}
+
+// start a new history with the current state
+func (scene *ScenePlay) InitHistory() {
+	scene.History = NewHistory(scene.Config.HistoryLimit)
+	scene.RecordHistory(FRAME_START)
+}
+
+// recording copies all life cells, so every running generation is only
+// recorded on request, otherwise every HISTORY_INTERVAL generations.
+// Single steps are always recorded, HashLife steps of 2^n generations
+// never.
+func (scene *ScenePlay) RecordsSteps() bool {
+	return scene.Config.StepSize() == 1 && (scene.Config.RecordSteps || scene.Config.RunOneStep)
+}
+
+// record the generation the game has run to since the last frame, if
+// it hasn't been recorded
+func (scene *ScenePlay) RecordRunning() {
+	if generation, ok := scene.History.Generation(); ok && generation != scene.Generations {
+		scene.RecordHistory(FRAME_STEP)
+	}
+}
+
+// record the current state, a bounded universe as a whole
+func (scene *ScenePlay) RecordHistory(kind int) {
+	area := image.Rect(0, 0, scene.Config.Width, scene.Config.Height)
+	if scene.Config.Unbounded {
+		area = scene.Engine.Bounds()
+	}
+
+	scene.History.Record(scene.Engine, area, kind, scene.Generations)
+}
+
+// go back or forth to a recorded frame. The engine is rebuilt from the
+// recorded cells, the game is paused then.
+func (scene *ScenePlay) RestoreFrame(index int) {
+	if !scene.History.CanSeek(index) {
+		return
+	}
+
+	// the settings may have changed since the frame was recorded
+	stepper, err := engine.New(scene.Config.EngineName(), scene.Config.EngineOptions())
+	if err != nil {
+		log.Printf("failed to restore frame: %s", err)
+		return
+	}
+
+	frame, cells, _ := scene.History.Seek(index)
+
+	if inverter, ok := stepper.(engine.Inverter); ok {
+		inverter.SetInverted(frame.Inverted)
+	}
+
+	for point, state := range cells {
+		stepper.Set(point.X, point.Y, state)
+	}
+
+	scene.Engine = stepper
+	scene.GenerationBase = frame.Generation
+	scene.Generations = frame.Generation
+	scene.Config.Paused = true
+}
+
 // load a pre-computed pattern from RLE file
 func (scene *ScenePlay) InitPattern() {
-	scene.Grids[0].LoadRLE(scene.Config.RLE)
+	if scene.Config.Rule.Elementary {
+		LoadRow(scene.Engine, scene.Config.RLE, scene.Config.Width)
+	} else {
+		LoadRLE(scene.Engine, scene.Config.RLE, scene.Config.Width, scene.Config.Height, !scene.Config.Unbounded)
+	}
 
 	// rule might have changed
 	scene.InitRuleCheckFunc()
 }
 
-// pre-render offscreen cache image
+// pre-render offscreen cache images, a dead and a life background
 func (scene *ScenePlay) InitCache() {
 	// setup theme
 	scene.Theme.SetGrid(scene.Config.ShowGrid)
 
+	scene.RenderBackground(scene.Cache, ColDead)
+	scene.RenderBackground(scene.InvertedCache, ColLife)
+}
+
+func (scene *ScenePlay) RenderBackground(cache *ebiten.Image, background int) {
 	if !scene.Config.ShowGrid {
-		scene.Cache.Fill(scene.Theme.Color(ColDead))
+		cache.Fill(scene.Theme.Color(background))
 		return
 	}
 
 	op := &ebiten.DrawImageOptions{}
 
-	scene.Cache.Fill(scene.Theme.Color(ColGrid))
+	cache.Fill(scene.Theme.Color(ColGrid))
 
 	for y := 0; y < scene.Config.Height; y++ {
 		for x := 0; x < scene.Config.Width; x++ {
 			op.GeoM.Reset()
-			op.GeoM.Translate(
-				float64(x*scene.Config.Cellsize),
-				float64(y*scene.Config.Cellsize),
-			)
+			op.GeoM.Translate(scene.CellPosition(x, y))
 
-			scene.Cache.DrawImage(scene.Theme.Tile(ColDead), op)
+			cache.DrawImage(scene.Theme.Tile(background), op)
 		}
 	}
 }
 
-// initialize grid[s], either using pre-computed from state or rle file, or random
-func (scene *ScenePlay) InitGrid() {
-	grida := NewGrid(scene.Config)
-	gridb := NewGrid(scene.Config)
+// (re-)create the world and cache images, a skewed hex grid needs some
+// more room
+func (scene *ScenePlay) InitWorld() {
+	width := scene.Config.Width * scene.Config.Cellsize
+	height := scene.Config.Height * scene.Config.Cellsize
 
-	// startup is delayed until user has selected options
-	grida.FillRandom()
+	width += int(math.Ceil(scene.RowOffset(0)))
 
-	scene.Grids = []*Grid{
-		grida,
-		gridb,
+	if scene.World != nil && scene.World.Bounds().Size() == image.Pt(width, height) {
+		return
 	}
 
-	scene.History = NewHistory(scene.Config.Height, scene.Config.Width)
+	if scene.World != nil {
+		scene.World.Deallocate()
+		scene.Cache.Deallocate()
+		scene.InvertedCache.Deallocate()
+	}
 
+	scene.World = ebiten.NewImage(width, height)
+	scene.Cache = ebiten.NewImage(width, height)
+	scene.InvertedCache = ebiten.NewImage(width, height)
+}
+
+// move the  cells into a universe of  the new size and  rebuild the
+// images,  the theme tiles and the camera.  An unbounded universe is
+// kept as it is, only the initial area changes.
+func (scene *ScenePlay) ResizeGrid() {
+	if !scene.Config.Unbounded {
+		stepper, err := engine.New(scene.Config.EngineName(), scene.Config.EngineOptions())
+		if err != nil {
+			// keep the old engine and its size
+			log.Printf("failed to resize the grid: %s", err)
+
+			scene.Config.Width = scene.Config.ResizeFrom.Dx()
+			scene.Config.Height = scene.Config.ResizeFrom.Dy()
+			scene.Config.SetupCamera()
+		} else {
+			scene.CopyCells(scene.Engine, stepper, scene.Config.ResizeFrom)
+			scene.Engine = stepper
+
+			// the new engine starts at generation 0, the counter goes on
+			scene.GenerationBase = scene.Generations
+		}
+	}
+
+	// the coordinates of the recorded cells don't fit anymore
+	scene.InitHistory()
+
+	scene.Config.ThemeManager = NewThemeManager(
+		scene.Config.ThemeManager.GetCurrentThemeName(), scene.Config.Cellsize)
+	scene.Theme = scene.Config.ThemeManager.GetCurrentTheme()
+
+	scene.InitWorld()
+	scene.InitCache()
+
+	scene.Camera.InitialZoomFactor = scene.Config.Zoomfactor
+	scene.Camera.InitialPosition = f64.Vec2{
+		scene.Config.InitialCamPos[0],
+		scene.Config.InitialCamPos[1],
+	}
+	scene.Camera.ZoomOutFactor = scene.Config.ZoomOutFactor
+	scene.Camera.Setup()
+}
+
+// copy the cells of a universe into the area of another one. Inverted
+// B0 universes  keep their phase,  so the area  around the old  one gets
+// the alive background.
+func (scene *ScenePlay) CopyCells(from, to engine.Stepper, area image.Rectangle) {
+	offset := area.Min
+
+	if inverter, ok := from.(engine.Inverter); ok && inverter.Inverted() {
+		target, ok := to.(engine.Inverter)
+		if !ok {
+			// the  other engine can't  store the  complement, so it
+			// gets the real cells
+			for y := 0; y < scene.Config.Height; y++ {
+				for x := 0; x < scene.Config.Width; x++ {
+					point := image.Pt(x, y)
+					if !point.In(area) || from.Get(x-offset.X, y-offset.Y) == engine.Dead {
+						to.Set(x, y, engine.Alive)
+					}
+				}
+			}
+
+			return
+		}
+
+		target.SetInverted(true)
+	}
+
+	from.Each(image.Rect(0, 0, area.Dx(), area.Dy()), func(x, y int) {
+		to.Set(x+offset.X, y+offset.Y, from.Get(x, y))
+	})
+}
+
+// initialize the engine, either using pre-computed from state or rle
+// file, or random. The current engine is kept if the settings don't
+// allow a new one.
+func (scene *ScenePlay) InitGrid() error {
+	stepper, err := engine.New(scene.Config.EngineName(), scene.Config.EngineOptions())
+	if err != nil {
+		return fmt.Errorf("failed to setup engine: %w", err)
+	}
+
+	scene.Engine = stepper
+
+	// a new engine starts at generation 0
+	scene.GenerationBase = 0
+	scene.Generations = 0
+
+	// startup is delayed until user has selected options
+	switch {
+	case scene.Config.Empty:
+	case scene.Config.Rule.Elementary:
+		// one-dimensional: only the first row, the others are the history
+		SeedRow(scene.Engine, scene.Config.InitialRow, scene.Config.Width, scene.Config.Density,
+			scene.Config.Seed)
+	default:
+		FillRandom(scene.Engine, scene.Config.Width, scene.Config.Height, scene.Config.Density,
+			scene.Config.Seed)
+	}
+
+	return nil
 }
 
 func (scene *ScenePlay) Init() {
@@ -662,32 +1055,31 @@ func (scene *ScenePlay) Init() {
 		ZoomOutFactor: scene.Config.ZoomOutFactor,
 	}
 
-	scene.World = ebiten.NewImage(
-		scene.Config.Width*scene.Config.Cellsize,
-		scene.Config.Height*scene.Config.Cellsize,
-	)
-
-	scene.Cache = ebiten.NewImage(
-		scene.Config.Width*scene.Config.Cellsize,
-		scene.Config.Height*scene.Config.Cellsize,
-	)
+	scene.InitWorld()
 
 	scene.Theme = scene.Config.ThemeManager.GetCurrentTheme()
 	scene.InitCache()
 
+	var err error
+
 	if scene.Config.DelayedStart && !scene.Config.Empty {
 		// do not fill the grid when the main menu comes up first, the
 		// user decides interactively what to do
 		scene.Config.Empty = true
-		scene.InitGrid()
+		err = scene.InitGrid()
 		scene.Config.Empty = false
 	} else {
-		scene.InitGrid()
+		err = scene.InitGrid()
+	}
+
+	if err != nil {
+		// the engine has already been checked during startup
+		log.Fatal(err)
 	}
 
 	scene.InitPattern()
+	scene.InitHistory()
 
-	scene.Index = 0
 	scene.TicksElapsed = 0
 
 	scene.LastCursorPos = make([]float64, 2)
@@ -704,9 +1096,5 @@ func bool2int(b bool) int {
 }
 
 func (scene *ScenePlay) InitRuleCheckFunc() {
-	if scene.Config.Rule.Definition == "B3/S23" {
-		scene.RuleCheckFunc = scene.CheckRuleB3S23
-	} else {
-		scene.RuleCheckFunc = scene.CheckRuleGeneric
-	}
+	scene.Engine.SetRule(scene.Config.Rule)
 }
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"math/rand"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tlinden/golsky/engine"
+	"github.com/tlinden/golsky/rle"
+)
+
+// initialize the universe  using a given RLE pattern, positioned ones
+// are put at their offset, others are centered inside the given area
+func LoadRLE(universe engine.Universe, pattern *rle.RLE, width, height int, bounded bool) {
+	if pattern == nil {
+		return
+	}
+
+	origin := pattern.Origin(width, height, bounded)
+	startX, startY := origin.X, origin.Y
+
+	for rowIndex, patternRow := range pattern.Pattern {
+		for colIndex := range patternRow {
+			if state := pattern.Pattern[rowIndex][colIndex]; state > 0 {
+				universe.Set(colIndex+startX, rowIndex+startY, uint8(state))
+			}
+		}
+	}
+}
+
+// initialize the area with random life cells using the given density.
+// The same seed always leads to the same soup.
+func FillRandom(universe engine.Universe, width, height, density int, seed int64) {
+	random := rand.New(rand.NewSource(seed))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if random.Intn(density) == 1 {
+				universe.Set(x, y, engine.Alive)
+			}
+		}
+	}
+}
+
+// seed the first row of a one-dimensional universe with a single cell
+// in the middle or with random cells
+func SeedRow(universe engine.Universe, mode string, width, density int, seed int64) {
+	if mode == ROW_SINGLE {
+		universe.Set(width/2, 0, engine.Alive)
+		return
+	}
+
+	FillRandom(universe, width, 1, density, seed)
+}
+
+// put the first row of a pattern centered into the first row of a
+// one-dimensional universe, the following rows will be computed
+func LoadRow(universe engine.Universe, pattern *rle.RLE, width int) {
+	if pattern == nil || len(pattern.Pattern) == 0 {
+		return
+	}
+
+	startX := (width / 2) - (pattern.Width / 2)
+
+	for colIndex, state := range pattern.Pattern[0] {
+		if state > 0 {
+			universe.Set(colIndex+startX, 0, engine.Alive)
+		}
+	}
+}
+
+// save the cells inside rect, which may have negative coordinates on
+// an unbounded plane. Life 1.05 files keep the whole rect with its top
+// left corner as #P offset, Life 1.06 files only the life cells. The
+// coordinates are written relative to origin, the center of a bounded
+// grid, see RLE.Origin. The seed of the random soup is stored as #D
+// seed comment. Life files can't store the dying cells of Generations
+// rules, such states are saved as RLE file with the same position
+// instead. Returns the name of the file written.
+func SaveState(filename, rule, format string, seed int64, rect image.Rectangle, origin image.Point,
+	universe engine.Universe) (string, error) {
+	meta := &rle.RLE{Comments: []string{"golsky state file", fmt.Sprintf("%s%d", SEED_COMMENT, seed)}}
+	grid := UniverseGrid(universe, rect, origin)
+
+	var err error
+
+	if rle.IsMultiState(grid) {
+		filename = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".rle"
+		meta.Offset, meta.Positioned = grid.Bounds().Min, true
+
+		err = rle.StoreGridToRLE(grid, filename, rule, meta)
+	} else {
+		err = rle.StoreGridToLife(grid, filename, rule, format, meta)
+	}
+
+	if err != nil {
+		return filename, fmt.Errorf("failed to write state file: %w", err)
+	}
+
+	return filename, nil
+}
+
+// the seed of the random soup of a state file, false if there is none
+func PatternSeed(pattern *rle.RLE) (int64, bool) {
+	for _, comment := range pattern.Comments {
+		value, found := strings.CutPrefix(comment, SEED_COMMENT)
+		if !found {
+			continue
+		}
+
+		seed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err == nil {
+			return seed, true
+		}
+	}
+
+	return 0, false
+}
+
+// save the cells inside rect to an RLE file, name, author and comments
+// are taken from the loaded pattern, if any
+func SaveRLE(filename, rule string, pattern *rle.RLE, rect image.Rectangle, universe engine.Universe) error {
+	return rle.StoreGridToRLE(UniverseGrid(universe, rect, image.Point{}), filename, rule, PatternMeta(pattern))
+}
+
+// save the cells inside rect to a plaintext file, see SaveRLE
+func SaveCells(filename string, pattern *rle.RLE, rect image.Rectangle, universe engine.Universe) error {
+	return rle.StoreGridToCells(UniverseGrid(universe, rect, image.Point{}), filename, PatternMeta(pattern))
+}
+
+// name, author and comments of the loaded pattern to be saved with a
+// part of the grid, nil if there is none
+func PatternMeta(pattern *rle.RLE) *rle.RLE {
+	if pattern == nil {
+		return nil
+	}
+
+	// the rectangle has its own position, the offset of the pattern
+	// doesn't apply to it
+	return &rle.RLE{Name: pattern.Name, Author: pattern.Author, Comments: pattern.Comments}
+}
+
+// the cells inside a rectangle of the universe, to be encoded without
+// copying them. The cell at origin is written as 0,0.
+type RectGrid struct {
+	Rect   image.Rectangle
+	origin image.Point
+	get    func(x, y int) uint8
+	each   func(rect image.Rectangle, action func(x, y int)) // optional
+}
+
+// the cells inside rect of the universe, the cell at origin is written
+// as 0,0. An inverted B0 universe stores the complement of its cells,
+// they are written as they are shown instead.
+func UniverseGrid(universe engine.Universe, rect image.Rectangle, origin image.Point) RectGrid {
+	if inverter, ok := universe.(engine.Inverter); ok && inverter.Inverted() {
+		// the stored cells are the dead ones, so every cell is visited
+		get := func(x, y int) uint8 {
+			return universe.Get(x, y) ^ engine.Alive
+		}
+
+		return RectGrid{Rect: rect, origin: origin, get: get}
+	}
+
+	return RectGrid{Rect: rect, origin: origin, get: universe.Get, each: universe.Each}
+}
+
+func (grid RectGrid) Bounds() image.Rectangle {
+	return grid.Rect.Sub(grid.origin)
+}
+
+func (grid RectGrid) Get(x, y int) uint8 {
+	return grid.get(x+grid.origin.X, y+grid.origin.Y)
+}
+
+// call action for every life cell inside rect, only visits life cells
+// if the universe can do it
+func (grid RectGrid) Each(rect image.Rectangle, action func(x, y int)) {
+	rect = rect.Add(grid.origin)
+
+	visit := func(x, y int) {
+		action(x-grid.origin.X, y-grid.origin.Y)
+	}
+
+	if grid.each != nil {
+		grid.each(rect, visit)
+		return
+	}
+
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			if grid.get(x, y) != engine.Dead {
+				visit(x, y)
+			}
+		}
+	}
+}
+
+// generate filenames for dumps
+func GetFilename(generations int64) string {
+	now := time.Now()
+	return fmt.Sprintf("dump-%s-%d.lif", now.Format("20060102150405"), generations)
+}
+
+func GetFilenameRect(generations int64, format string) string {
+	now := time.Now()
+	return fmt.Sprintf("rect-%s-%d.%s", now.Format("20060102150405"), generations, format)
+}
@@ -30,6 +30,10 @@ type Theme struct {
 	Colors    map[int]color.RGBA
 	Name      string
 	ShowGrid  bool
+	Cellsize  int
+
+	// tiles of colors defined by rule files, created on demand
+	ColorTiles, ColorGridTiles map[color.RGBA]*ebiten.Image
 }
 
 type ThemeDef struct {
@@ -72,7 +76,10 @@ var THEMES = map[string]ThemeDef{
 // create a new theme
 func NewTheme(def ThemeDef, cellsize int, name string) Theme {
 	theme := Theme{
-		Name: name,
+		Name:           name,
+		Cellsize:       cellsize,
+		ColorTiles:     map[color.RGBA]*ebiten.Image{},
+		ColorGridTiles: map[color.RGBA]*ebiten.Image{},
 		Colors: map[int]color.RGBA{
 			ColLife: HexColor2RGBA(def.life),
 			ColDead: HexColor2RGBA(def.dead),
@@ -110,6 +117,37 @@ func (theme *Theme) Tile(col int) *ebiten.Image {
 	return theme.Tiles[col]
 }
 
+// return the  tile image for a cell state  of a Generations rule. Life
+// cells use the life color, the dying states are spread over the age
+// colors, the younger a dying cell, the closer to the life color.
+func (theme *Theme) StateTile(state uint8, states int) *ebiten.Image {
+	if state <= 1 || states <= 2 {
+		return theme.Tile(ColLife)
+	}
+
+	age := (int(state) - 2) * (ColAge4 - ColAge1 + 1) / (states - 2)
+
+	return theme.Tile(ColAge1 + age)
+}
+
+// return the tile image for an arbitrary color
+func (theme *Theme) ColorTile(col color.RGBA) *ebiten.Image {
+	tiles := theme.ColorTiles
+	if theme.ShowGrid {
+		tiles = theme.ColorGridTiles
+	}
+
+	tile, ok := tiles[col]
+	if !ok {
+		tile = ebiten.NewImage(theme.Cellsize, theme.Cellsize)
+		FillCell(tile, theme.Cellsize, col, bool2int(theme.ShowGrid))
+
+		tiles[col] = tile
+	}
+
+	return tile
+}
+
 func (theme *Theme) Color(col int) color.RGBA {
 	return theme.Colors[col]
 }
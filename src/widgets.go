@@ -187,6 +187,42 @@ func NewCombobox(items []string, selected string,
 	return comboBox
 }
 
+func NewTextInput(text string, width int,
+	changed func(args *widget.TextInputChangedEventArgs),
+	submit func(args *widget.TextInputChangedEventArgs)) *widget.TextInput {
+
+	input := widget.NewTextInput(
+		widget.TextInputOpts.WidgetOpts(
+			widget.WidgetOpts.MinSize(width, 0),
+			widget.WidgetOpts.LayoutData(widget.RowLayoutData{
+				Position: widget.RowLayoutPositionCenter,
+				Stretch:  true,
+			}),
+		),
+		widget.TextInputOpts.Image(&widget.TextInputImage{
+			Idle:     image.NewNineSliceColor(color.NRGBA{100, 100, 100, 255}),
+			Disabled: image.NewNineSliceColor(color.NRGBA{100, 100, 100, 255}),
+		}),
+		widget.TextInputOpts.Face(*FontRenderer.FontSmall),
+		widget.TextInputOpts.Color(&widget.TextInputColor{
+			Idle:          color.NRGBA{254, 255, 255, 255},
+			Disabled:      color.NRGBA{200, 200, 200, 255},
+			Caret:         color.NRGBA{254, 255, 255, 255},
+			DisabledCaret: color.NRGBA{200, 200, 200, 255},
+		}),
+		widget.TextInputOpts.Padding(widget.NewInsetsSimple(5)),
+		widget.TextInputOpts.CaretOpts(
+			widget.CaretOpts.Size(*FontRenderer.FontSmall, 2),
+		),
+		widget.TextInputOpts.ChangedHandler(changed),
+		widget.TextInputOpts.SubmitHandler(submit),
+	)
+
+	input.SetText(text)
+
+	return input
+}
+
 func NewLabel(text string) *widget.Text {
 	return widget.NewText(
 		widget.TextOpts.Text(text, *FontRenderer.FontSmall, color.White),
@@ -254,17 +290,31 @@ func NewRowContainer(title string) *RowContainer {
 	}
 }
 
+// plain container stacking its children vertically
+func NewVerticalContainer() *widget.Container {
+	return widget.NewContainer(
+		widget.ContainerOpts.Layout(widget.NewRowLayout(
+			widget.RowLayoutOpts.Direction(widget.DirectionVertical),
+			widget.RowLayoutOpts.Spacing(0),
+		)),
+	)
+}
+
 func NewColumnContainer() *widget.Container {
-	colcontainer := widget.NewContainer(
+	return NewGridContainer(2)
+}
+
+func NewGridContainer(columns int) *widget.Container {
+	gridcontainer := widget.NewContainer(
 		widget.ContainerOpts.Layout(
 			widget.NewGridLayout(
-				widget.GridLayoutOpts.Columns(2),
+				widget.GridLayoutOpts.Columns(columns),
 				widget.GridLayoutOpts.Spacing(5, 0),
 			),
 		),
 	)
 
-	return colcontainer
+	return gridcontainer
 }
 
 func LoadButtonImage() (*widget.ButtonImage, error) {